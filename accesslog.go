@@ -0,0 +1,141 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessLogFormat defines the line format of the access log.
+type AccessLogFormat int
+
+const (
+	// AccessLogCommon is the Common Log Format of the Apache httpd, e.g.
+	//   127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326
+	AccessLogCommon AccessLogFormat = 0
+
+	// AccessLogCombined is the Common Log Format followed by the quoted Referer and User-Agent headers.
+	AccessLogCombined AccessLogFormat = 1
+
+	// AccessLogJSON writes a json object per line, which additionally contains the matched route pattern and the
+	// duration of the request in milliseconds.
+	AccessLogJSON AccessLogFormat = 2
+)
+
+// accessLog writes the lines of concurrent requests without interleaving.
+type accessLog struct {
+	mutex  sync.Mutex
+	writer io.Writer
+	format AccessLogFormat
+}
+
+// accessLogEntry is the line of the AccessLogJSON format.
+type accessLogEntry struct {
+	Time       string  `json:"time"`
+	RemoteAddr string  `json:"remoteAddr"`
+	User       string  `json:"user,omitempty"`
+	Method     string  `json:"method"`
+	Route      string  `json:"route"`
+	URI        string  `json:"uri"`
+	Proto      string  `json:"proto"`
+	Status     int     `json:"status"`
+	Bytes      int64   `json:"bytes"`
+	DurationMs float64 `json:"durationMs"`
+	Referer    string  `json:"referer,omitempty"`
+	UserAgent  string  `json:"userAgent,omitempty"`
+}
+
+// SetAccessLog writes a line per request in the given format to the writer. A nil writer disables the access log,
+// which is the default.
+func (s *Server) SetAccessLog(writer io.Writer, format AccessLogFormat) {
+	if writer == nil {
+		s.accessLog = nil
+		return
+	}
+	s.accessLog = &accessLog{writer: writer, format: format}
+}
+
+// log writes the line of the finished request. Failures of the writer are ignored, because there is nobody left
+// to report them to.
+func (a *accessLog) log(writer *responseWriter, request *http.Request, start time.Time) {
+	status := writer.status
+	if status == 0 {
+		status = http.StatusOK // the default of net/http, if nothing has been written
+	}
+
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		host = request.RemoteAddr
+	}
+
+	user, _, _ := request.BasicAuth()
+
+	uri := request.RequestURI
+	if len(uri) == 0 {
+		uri = request.URL.RequestURI()
+	}
+
+	var line []byte
+	switch a.format {
+	case AccessLogJSON:
+		line, _ = json.Marshal(accessLogEntry{
+			Time:       start.Format(time.RFC3339Nano),
+			RemoteAddr: host,
+			User:       user,
+			Method:     request.Method,
+			Route:      routeOf(request),
+			URI:        uri,
+			Proto:      request.Proto,
+			Status:     status,
+			Bytes:      writer.bytes,
+			DurationMs: float64(time.Since(start)) / float64(time.Millisecond),
+			Referer:    request.Referer(),
+			UserAgent:  request.UserAgent(),
+		})
+	default:
+		size := "-"
+		if writer.bytes > 0 {
+			size = strconv.FormatInt(writer.bytes, 10)
+		}
+
+		sb := &strings.Builder{}
+		sb.WriteString(host + " - " + orDash(user) + " [" + start.Format("02/Jan/2006:15:04:05 -0700") + "] ")
+		sb.WriteString(strconv.Quote(request.Method+" "+uri+" "+request.Proto) + " ")
+		sb.WriteString(strconv.Itoa(status) + " " + size)
+		if a.format == AccessLogCombined {
+			sb.WriteString(" " + strconv.Quote(orDash(request.Referer())) + " " + strconv.Quote(orDash(request.UserAgent())))
+		}
+		line = []byte(sb.String())
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	_, _ = a.writer.Write(append(line, '\n'))
+}
+
+func orDash(s string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return s
+}
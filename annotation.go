@@ -15,16 +15,107 @@
 package http
 
 // AnnotationQueryParam only applies to method parameters and uses the names as the url query parameter. value' denotes
-// the method variable name and 'alias' an optional name (e.g. accept-language)
+// the method variable name and 'alias' an optional name (e.g. accept-language). Slice parameters receive all values,
+// either repeated ("style":"multi", the default) or comma separated ("style":"csv"). The parameter is optional:
+// if absent, pointers are nil and all other types get their zero value, unless a "default" value is given.
+// Declaring "required":true causes an Error with the id IdParamMissing instead, e.g.
+//   @ee.http.QueryParam("value":"limit","default":"10")
+//   @ee.http.QueryParam("value":"tenant","required":true)
 const AnnotationQueryParam = "ee.http.QueryParam"
 
 // AnnotationHeaderParam only applies to method parameters and uses the names from the http request. 'value' denotes
-// the method variable name and 'alias' an optional name (e.g. accept-language)
+// the method variable name and 'alias' an optional name (e.g. accept-language). Slice parameters receive all values,
+// either comma separated ("style":"csv", the default) or from repeated header lines only ("style":"multi").
+// Like AnnotationQueryParam, it supports "default" and "required".
 const AnnotationHeaderParam = "ee.http.HeaderParam"
 
+// AnnotationCookieParam only applies to method parameters and uses the names of the request cookies. 'value' denotes
+// the method variable name and 'alias' an optional cookie name (e.g. SID). Like AnnotationQueryParam, it supports
+// "default" and "required".
+const AnnotationCookieParam = "ee.http.CookieParam"
+
+// AnnotationFormParam only applies to method parameters and uses the names from an url encoded or multipart form.
+// 'value' denotes the method variable name and 'alias' an optional field name. Parameters of type
+// *multipart.FileHeader or io.Reader are bound to the file part of that name. Like AnnotationQueryParam, it supports
+// "style", "default" and "required".
+const AnnotationFormParam = "ee.http.FormParam"
+
+// AnnotationBeanParam only applies to methods and binds a whole struct, denoted by 'value', at once. The fields of
+// the struct are annotated by AnnotationPathParam, AnnotationQueryParam, AnnotationHeaderParam or
+// AnnotationCookieParam. For fields, the optional 'alias' denotes the request name, which is otherwise the
+// field name, e.g.
+//   @ee.http.BeanParam("filter")
+//   ...
+//   type Filter struct {
+//     // @ee.http.QueryParam("alias":"q","required":true)
+//     Query string
+//   }
+const AnnotationBeanParam = "ee.http.BeanParam"
+
+// AnnotationPathParam only applies to fields of a struct bound by AnnotationBeanParam and uses the optional
+// 'alias' or otherwise the field name as the named route variable.
+const AnnotationPathParam = "ee.http.PathParam"
+
+// AnnotationBodyParam only applies to methods and decodes the request body into the method parameter denoted by
+// 'value'. Only a single body parameter per method is allowed, e.g.
+//   @ee.http.BodyParam("value":"dto")
+const AnnotationBodyParam = "ee.http.BodyParam"
+
+// AnnotationValidate applies to methods and to fields of structs. On methods, 'value' denotes the validated method
+// parameter. The rules are checked after binding the request and all violations are returned together as an Error
+// with the id IdValidation. Fields of bound structs are validated recursively. The supported rules are 'min' and
+// 'max' for numbers, 'minLength' and 'maxLength' for strings, slices and maps, 'pattern' for strings and a comma
+// separated 'enum' of allowed values, e.g.
+//   @ee.http.Validate("value":"limit","min":1,"max":100)
+//   @ee.http.Validate("value":"order","enum":"asc,desc")
+//   ...
+//   type Person struct {
+//     // @ee.http.Validate("minLength":1,"maxLength":64,"pattern":"^[a-zA-Z ]+$")
+//     Name string
+//   }
+const AnnotationValidate = "ee.http.Validate"
+
+// AnnotationConsumes only applies to methods and restricts the comma separated media types, which are accepted as
+// request body. By default, all media types of the registered codecs and MediaTypeForm are accepted by a body
+// parameter and MediaTypeForm and MediaTypeMultipartForm for form parameters. Other media types are rejected with
+// an Error with the id IdUnsupportedMediaType, e.g.
+//   @ee.http.Consumes("application/json")
+const AnnotationConsumes = "ee.http.Consumes"
+
+// AnnotationProduces only applies to methods and restricts the comma separated media types, which are offered to
+// the client. By default, the media types of all registered codecs are offered, e.g.
+//   @ee.http.Produces("application/json, text/csv")
+//
+// Slices and channels are additionally offered as MediaTypeNDJSON and iterators only as such, so that a method can
+// be restricted to streaming, e.g.
+//   @ee.http.Produces("application/x-ndjson")
+const AnnotationProduces = "ee.http.Produces"
+
+// AnnotationStatus only applies to methods and declares the status code of a successful call, which is 200 by
+// default or 204 for methods without payload. Results of type Response or implementing StatusCode() int may override it per call, e.g.
+//   @ee.http.Status(201)
+const AnnotationStatus = "ee.http.Status"
+
+// AnnotationNilStatus only applies to methods and declares the status code, if the payload is a nil pointer, map
+// or interface. Either 204 (the default) for an empty response or 404 for an Error with the id IdNotFound, e.g.
+//   @ee.http.NilStatus(404)
+//
+// A method returns a single payload, optionally followed by an int status (which overrides the declared status if
+// not 0), a http.Header (whose values are added to the response) and an error, which is always the last value.
+// Methods without a payload respond with 204 by default. Other signatures are rejected at registration time.
+const AnnotationNilStatus = "ee.http.NilStatus"
+
 // AnnotationMethod only applies to methods and describes which http verb is applied for routing.
 const AnnotationMethod = "ee.http.Method"
 
+// AnnotationWebSocket only applies to methods and upgrades the connection to a WebSocket, which is passed as the
+// *WebSocket parameter. The route is requested by GET, which does not need to be declared by AnnotationMethod.
+// Other parameters are bound and validated as usual before the upgrade and the method may only return an error, e.g.
+//   @ee.http.WebSocket
+//   @ee.http.Route("/chat/:room")
+//   func (c *Chat) Join(ws *http.WebSocket, room string) error
+const AnnotationWebSocket = "ee.http.WebSocket"
+
 // AnnotationRoute can be used for a struct and/or struct methods. The value is the route with path variables
 // preceded by a : like the following example:
 //   /api/v1/sms/:id
@@ -33,4 +124,4 @@ const AnnotationRoute = "ee.http.Route"
 
 // AnnotationStereotypeController is a non http annotation used to group OpenAPI endpoints together, using the given
 // name.
-const AnnotationStereotypeController = "ee.stereotype.Controller"
\ No newline at end of file
+const AnnotationStereotypeController = "ee.stereotype.Controller"
@@ -0,0 +1,216 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// placeholder matches a {key} in a message template.
+var placeholder = regexp.MustCompile(`{([^{}]+)}`)
+
+// A MessageCatalog contains message templates per locale, keyed by Error.Id. A template may contain placeholders
+// like {name}, which are replaced by the according entries of the Error.Details, e.g.
+//   "ee.http.param.missing": "Der Parameter {name} fehlt."
+type MessageCatalog struct {
+	mutex    sync.RWMutex
+	fallback string
+	messages map[string]map[string]string // messages maps locale → id → template
+}
+
+// NewMessageCatalog creates an empty catalog. The fallback locale is used, if none of the accepted languages
+// of a request provides a message.
+func NewMessageCatalog(fallback string) *MessageCatalog {
+	return &MessageCatalog{fallback: normalizeLocale(fallback), messages: map[string]map[string]string{}}
+}
+
+// Add merges the templates into the locale, e.g. from an embedded map. Existing templates are replaced.
+func (c *MessageCatalog) Add(locale string, messages map[string]string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	locale = normalizeLocale(locale)
+	templates := c.messages[locale]
+	if templates == nil {
+		templates = map[string]string{}
+		c.messages[locale] = templates
+	}
+
+	for id, template := range messages {
+		templates[id] = template
+	}
+}
+
+// Load reads a json object of templates keyed by id and adds them to the locale.
+func (c *MessageCatalog) Load(locale string, reader io.Reader) error {
+	buf, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	messages := map[string]string{}
+	if err := json.Unmarshal(buf, &messages); err != nil {
+		return fmt.Errorf("invalid messages of locale '%s': %w", locale, err)
+	}
+
+	c.Add(locale, messages)
+	return nil
+}
+
+// LoadFile adds the templates of the json file to the locale.
+func (c *MessageCatalog) LoadFile(locale, fname string) error {
+	file, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return c.Load(locale, file)
+}
+
+// LoadDir adds the templates of all json files in the directory, whose names are their locales, e.g. de-CH.json.
+func (c *MessageCatalog) LoadDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	for _, fname := range files {
+		if err := c.LoadFile(strings.TrimSuffix(filepath.Base(fname), ".json"), fname); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Message returns the template of the id for the best matching locale of the Accept-Language header, with the
+// placeholders replaced by the details.
+func (c *MessageCatalog) Message(acceptLanguage, id string, details interface{}) (string, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	for _, locale := range c.locales(acceptLanguage) {
+		if template, ok := c.messages[locale][id]; ok {
+			return expandPlaceholders(template, details), true
+		}
+	}
+	return "", false
+}
+
+// Localize returns a copy of the error chain, whose missing localized messages have been filled from the catalog.
+func (c *MessageCatalog) Localize(err *Error, acceptLanguage string) *Error {
+	if err == nil {
+		return nil
+	}
+
+	tmp := *err
+	if len(tmp.LocalizedMessage) == 0 {
+		tmp.LocalizedMessage, _ = c.Message(acceptLanguage, tmp.Id, tmp.Details)
+	}
+	tmp.CausedBy = c.Localize(tmp.CausedBy, acceptLanguage)
+	return &tmp
+}
+
+// locales returns the available locales in the order of preference. A language range like de-CH is followed by
+// its base language de and any other available region of it. The fallback comes last.
+func (c *MessageCatalog) locales(acceptLanguage string) []string {
+	ranges := parseAccept(acceptLanguage) // Accept-Language has the same syntax as Accept
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+
+	var res []string
+	seen := map[string]bool{}
+	add := func(locale string) {
+		if _, ok := c.messages[locale]; ok && !seen[locale] {
+			seen[locale] = true
+			res = append(res, locale)
+		}
+	}
+
+	for _, r := range ranges {
+		if r.q <= 0 || r.mediaType == "*" {
+			continue
+		}
+
+		locale := normalizeLocale(r.mediaType)
+		add(locale)
+
+		base := strings.SplitN(locale, "-", 2)[0]
+		add(base)
+
+		var regions []string
+		for available := range c.messages {
+			if strings.HasPrefix(available, base+"-") {
+				regions = append(regions, available)
+			}
+		}
+		sort.Strings(regions)
+		for _, region := range regions {
+			add(region)
+		}
+	}
+
+	add(c.fallback)
+	return res
+}
+
+// SetMessageCatalog localizes all errors before they are written. A nil catalog disables the localization.
+func (s *Server) SetMessageCatalog(catalog *MessageCatalog) {
+	s.messages = catalog
+}
+
+// localize returns the error with localized messages, if a catalog has been set.
+func (s *Server) localize(err *Error, request *http.Request) *Error {
+	if s.messages == nil {
+		return err
+	}
+	return s.messages.Localize(err, request.Header.Get("Accept-Language"))
+}
+
+// expandPlaceholders replaces each {key} by the according entry of the details, which must be a map or a struct
+// with json fields. Unknown placeholders are left as is.
+func expandPlaceholders(template string, details interface{}) string {
+	if details == nil || !strings.Contains(template, "{") {
+		return template
+	}
+
+	values := map[string]interface{}{}
+	if buf, err := json.Marshal(details); err != nil || json.Unmarshal(buf, &values) != nil {
+		return template
+	}
+
+	return placeholder.ReplaceAllStringFunc(template, func(match string) string {
+		if v, ok := values[match[1:len(match)-1]]; ok {
+			return fmt.Sprint(v)
+		}
+		return match
+	})
+}
+
+// normalizeLocale converts locales like de_CH into the lower case form of language tags, like de-ch.
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
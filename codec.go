@@ -0,0 +1,188 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A Codec encodes and decodes values of a specific media type.
+type Codec interface {
+	// Encode writes the serialized value.
+	Encode(writer io.Writer, v interface{}) error
+	// Decode reads the serialized value into the pointer v.
+	Decode(reader io.Reader, v interface{}) error
+}
+
+// MediaTypeJSON is served by default.
+const MediaTypeJSON = "application/json"
+
+// MediaTypeXML is only served, if XMLCodec has been registered.
+const MediaTypeXML = "application/xml"
+
+// MediaTypeForm is the media type of url encoded forms, which can be decoded into maps and structs.
+const MediaTypeForm = "application/x-www-form-urlencoded"
+
+// MediaTypeMultipartForm is the media type of multipart forms.
+const MediaTypeMultipartForm = "multipart/form-data"
+
+type mediaCodec struct {
+	mediaType string
+	codec     Codec
+}
+
+// RegisterCodec registers the codec for the given media type, e.g. text/csv, or replaces an existing one. The
+// response media type is negotiated by the Accept header of the request. If the client accepts multiple media
+// types equally, the codec which has been registered first is picked. By default, the server only offers
+// MediaTypeJSON. Codecs must be registered before the controllers, whose endpoints offer them.
+func (s *Server) RegisterCodec(mediaType string, codec Codec) {
+	mediaType = strings.ToLower(mediaType)
+	for i, c := range s.codecs {
+		if c.mediaType == mediaType {
+			s.codecs[i].codec = codec
+			return
+		}
+	}
+	s.codecs = append(s.codecs, mediaCodec{mediaType: mediaType, codec: codec})
+}
+
+// codec returns the codec for the media type or nil.
+func (s *Server) codec(mediaType string) Codec {
+	for _, c := range s.codecs {
+		if c.mediaType == mediaType {
+			return c.codec
+		}
+	}
+	return nil
+}
+
+// mediaTypes returns all registered media types in registration order.
+func (s *Server) mediaTypes() []string {
+	res := make([]string, 0, len(s.codecs))
+	for _, c := range s.codecs {
+		res = append(res, c.mediaType)
+	}
+	return res
+}
+
+// mediaRange is a parsed entry of an Accept header, like text/* or application/json;q=0.8
+type mediaRange struct {
+	mediaType string
+	q         float64
+}
+
+// matches returns the specificity of the match or -1.
+func (r mediaRange) matches(mediaType string) int {
+	switch {
+	case r.mediaType == mediaType:
+		return 2
+	case r.mediaType == "*/*":
+		return 0
+	case strings.HasSuffix(r.mediaType, "/*") && strings.HasPrefix(mediaType, r.mediaType[:len(r.mediaType)-1]):
+		return 1
+	default:
+		return -1
+	}
+}
+
+// parseAccept parses the media ranges of an Accept header. Invalid q-values are treated as 1.
+func parseAccept(accept string) []mediaRange {
+	var res []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		r := mediaRange{mediaType: strings.ToLower(strings.TrimSpace(params[0])), q: 1}
+		if len(r.mediaType) == 0 {
+			continue
+		}
+
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && strings.TrimSpace(kv[0]) == "q" {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64); err == nil {
+					r.q = q
+				}
+			}
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+// negotiate picks the offered media type with the highest quality in the Accept header. The quality of an offer
+// is defined by its most specific matching media range. If the header is empty, the first offer is returned.
+func negotiate(accept string, offers []string) (string, bool) {
+	if len(offers) == 0 {
+		return "", false
+	}
+
+	ranges := parseAccept(accept)
+	if len(ranges) == 0 {
+		return offers[0], true
+	}
+
+	best := ""
+	bestQ := 0.0
+	for _, offer := range offers {
+		q := 0.0
+		specificity := -1
+		for _, r := range ranges {
+			if s := r.matches(offer); s > specificity {
+				specificity = s
+				q = r.q
+			}
+		}
+
+		if q > bestQ {
+			best = offer
+			bestQ = q
+		}
+	}
+
+	return best, bestQ > 0
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(writer io.Writer, v interface{}) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(buf)
+	return err
+}
+
+func (jsonCodec) Decode(reader io.Reader, v interface{}) error {
+	return json.NewDecoder(reader).Decode(v)
+}
+
+// XMLCodec encodes and decodes by encoding/xml. It is not registered by default, because it can neither encode maps
+// nor slices without a root element, so it must be enabled explicitly for suited payloads, e.g.
+//   srv.RegisterCodec(MediaTypeXML, XMLCodec)
+var XMLCodec Codec = xmlCodec{}
+
+type xmlCodec struct{}
+
+func (xmlCodec) Encode(writer io.Writer, v interface{}) error {
+	return xml.NewEncoder(writer).Encode(v)
+}
+
+func (xmlCodec) Decode(reader io.Reader, v interface{}) error {
+	return xml.NewDecoder(reader).Decode(v)
+}
@@ -16,13 +16,14 @@ package http
 
 import (
 	"database/sql"
-	"encoding/json"
+	"encoding"
 	"fmt"
 	"github.com/golangee/reflectplus"
 	"net/http"
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // A Scanner is SQL scanner compatible, but only needs tp scan from a string
@@ -91,19 +92,34 @@ func NewController(srv *Server, ctr interface{}) (*Controller, error) {
 			panic("reflectplus data does not match actual reflect data: method '" + method.Name + "' not found")
 		}
 
-		methodParams, err := scanMethodParams(*meta, method)
+		ep, err := newEndpoint(srv, *meta, method)
 		if err != nil {
 			return nil, reflectplus.PositionalError(method, err)
 		}
+		ep.refFunc = refFunc
+		if err := checkDefaults(srv, ep.params, refFunc.Type()); err != nil {
+			return nil, reflectplus.PositionalError(method, err)
+		}
+
+		if ep.payload == pkIterator && !isIteratorFunc(refFunc.Type().Out(ep.results.payload)) {
+			return nil, reflectplus.PositionalError(method, fmt.Errorf("an iterator must be declared as func(yield func(T) error) error"))
+		}
+
+		if ep.payload == pkEvents && ep.results.payload >= 0 {
+			if out := refFunc.Type().Out(ep.results.payload); out.Kind() != reflect.Chan || out.ChanDir()&reflect.RecvDir == 0 {
+				return nil, reflectplus.PositionalError(method, fmt.Errorf("a channel must be declared as chan T or <-chan T, but is %s", out))
+			}
+		}
 
 		for _, prefixRoute := range prefixRoutes {
 			for _, route := range routes {
 				for _, verb := range verbs {
 					path := joinPaths(prefixRoute, route)
 
-					fmt.Printf("registered route %s %s by %s \n", method.Name, path, reflectplus.PositionalError(method, nil).Error())
+					srv.logger.Log(LevelInfo, "registered route", "verb", verb, "route", path, "method", method.Name,
+						"source", reflectplus.PositionalError(method, nil).Error())
 					srv.handle(verb, path, func(writer http.ResponseWriter, request *http.Request, params KeyValues) error {
-						return routedFunc(method, refFunc, methodParams, writer, request, params)
+						return routedFunc(srv, ep, writer, request, params)
 					})
 
 				}
@@ -115,108 +131,290 @@ func NewController(srv *Server, ctr interface{}) (*Controller, error) {
 	return res, nil
 }
 
-func routedFunc(method reflectplus.Method, refFunc reflect.Value, methodParams []methodParam, writer http.ResponseWriter, request *http.Request, params KeyValues) error {
+func routedFunc(srv *Server, ep *endpoint, writer http.ResponseWriter, request *http.Request, params KeyValues) error {
+	method, refFunc, methodParams := ep.method, ep.refFunc, ep.params
 	args := make([]reflect.Value, 0, len(method.Params))
+	var stream *EventStream
+	webSocketIdx := -1
+
+	// binary payloads are streamed without negotiation, because their actual media type is often unknown in advance
+	mediaType, acceptable := "", true
+	if len(ep.produces) > 0 {
+		mediaType = ep.produces[0]
+	}
+
+	if ep.results.payload >= 0 && !ep.raw && ep.payload != pkBinary {
+		mediaType, acceptable = negotiate(request.Header.Get("Accept"), ep.produces)
+	}
+
+	if !acceptable {
+		return &Error{
+			Id:      IdNotAcceptable,
+			Message: "none of the accepted media types can be produced",
+			Details: map[string]interface{}{
+				"accept":    request.Header.Get("Accept"),
+				"supported": ep.produces,
+			},
+		}
+	}
+
+	contentType := ""
+	if len(ep.consumes) > 0 {
+		var err error
+		if contentType, err = ep.contentType(request); err != nil {
+			return err
+		}
+	}
 
-	fmt.Println(method.Name)
 	for _, p := range methodParams {
 		switch p.paramType {
 		case ptCtx:
 			args = append(args, reflect.ValueOf(request.Context()))
-		case ptPath:
-			parsedType, err := scanToType(params.ByName(p.Alias()), p.param.Type, refFunc.Type().In(p.idx))
+		case ptPath, ptQuery, ptHeader, ptCookie:
+			value, err := bindValues(srv, requestValues(p, request, params), p, refFunc.Type().In(p.idx))
 			if err != nil {
 				return err
 			}
-			args = append(args, reflect.ValueOf(parsedType))
-		case ptQuery:
-			url := request.URL
-			strValue := url.Query().Get(p.Alias())
-			parsedType, err := scanToType(strValue, p.param.Type, refFunc.Type().In(p.idx))
+			args = append(args, value)
+		case ptForm:
+			if err := parseForm(request); err != nil {
+				return WrapError(IdBodyInvalid, err)
+			}
+
+			dstType := refFunc.Type().In(p.idx)
+			switch dstType {
+			case fileHeaderType, readerType:
+				header := formFile(request, p.Alias())
+				if header == nil && p.required {
+					return p.newError(IdParamMissing, fmt.Sprintf("the required form file '%s' is missing", p.Alias()), nil)
+				}
+
+				if dstType == fileHeaderType {
+					args = append(args, reflect.ValueOf(header))
+					continue
+				}
+
+				if header == nil {
+					args = append(args, reflect.Zero(readerType))
+					continue
+				}
+
+				file, err := header.Open()
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+
+				args = append(args, reflect.ValueOf(file))
+			default:
+				value, err := bindValues(srv, requestValues(p, request, params), p, dstType)
+				if err != nil {
+					return err
+				}
+				args = append(args, value)
+			}
+		case ptBean:
+			value, err := bindBean(srv, p, refFunc.Type().In(p.idx), request, params)
 			if err != nil {
 				return err
 			}
-			args = append(args, reflect.ValueOf(parsedType))
-
-		case ptHeader:
-			strValue := request.Header.Get(p.Alias())
-			parsedType, err := scanToType(strValue, p.param.Type, refFunc.Type().In(p.idx))
+			args = append(args, value)
+		case ptBody:
+			body := reflect.New(refFunc.Type().In(p.idx))
+			if contentType == MediaTypeForm {
+				if err := decodeForm(srv, request, body); err != nil {
+					return err
+				}
+			} else if err := srv.codec(contentType).Decode(request.Body, body.Interface()); err != nil {
+				return WrapError(IdBodyInvalid, err)
+			}
+			args = append(args, body.Elem())
+		case ptInjected:
+			value, err := srv.inject(request, refFunc.Type().In(p.idx))
 			if err != nil {
 				return err
 			}
-			args = append(args, reflect.ValueOf(parsedType))
+			args = append(args, value)
 		case ptRequest:
 			args = append(args, reflect.ValueOf(request))
 		case ptResponseWriter:
 			args = append(args, reflect.ValueOf(writer))
+		case ptEventStream:
+			stream = newEventStream(writer, request, srv.eventKeepAlive)
+			defer stream.close() // stops the keep-alive comments, even if the method panics
+			args = append(args, reflect.ValueOf(stream))
+		case ptWebSocket:
+			webSocketIdx = len(args) // the connection is upgraded after all other parameters are valid
+			args = append(args, reflect.Zero(refFunc.Type().In(p.idx)))
 		default:
 			panic("method parameter type " + strconv.Itoa(int(p.paramType)) + " not implemented")
 		}
 
 	}
-	res := refFunc.Call(args)
-	for _, v := range res {
-		if err, ok := v.Interface().(error); ok {
+	var violations []Violation
+	for i, p := range methodParams {
+		violations = p.validation.validate(p.Alias(), args[i], violations)
+	}
+
+	if len(violations) > 0 {
+		return &Error{Id: IdValidation, Message: "the request violates validation rules", Details: violations}
+	}
+
+	if webSocketIdx >= 0 {
+		ws, err := upgradeWebSocket(writer, request)
+		if err != nil {
 			return err
 		}
+		args[webSocketIdx] = reflect.ValueOf(ws)
+		defer func() {
+			if r := recover(); r != nil {
+				_ = ws.CloseWith(CloseInternalError, "")
+				panic(r)
+			}
+		}()
+
+		// the connection has been hijacked, so an error can only be sent as close frame
+		res := call(srv, ep, request, args)
+		closeCode := CloseNormal
+		if r := ep.results; r.err >= 0 && !res[r.err].IsNil() {
+			srv.logAborted(request, res[r.err].Interface().(error))
+			closeCode = CloseInternalError
+		}
+
+		if err := ws.CloseWith(closeCode, ""); err != nil {
+			srv.logAborted(request, err)
+		}
+		return nil
 	}
-	// TODO how to process serialization responses?
-	for _, v := range res {
-		val := v.Interface()
-		if val == nil {
-			continue
+
+	res := call(srv, ep, request, args)
+	r := ep.results
+	if stream != nil && stream.close() {
+		// the events have already been sent, so an error cannot be reported to the client anymore
+		if r.err >= 0 && !res[r.err].IsNil() {
+			srv.logAborted(request, res[r.err].Interface().(error))
 		}
-		b, err := json.Marshal(val)
-		if err != nil {
-			return err
+		return nil
+	}
+
+	if r.err >= 0 && !res[r.err].IsNil() {
+		return res[r.err].Interface().(error)
+	}
+
+	status := ep.status
+	if r.status >= 0 && res[r.status].Int() != 0 {
+		status = int(res[r.status].Int())
+	}
+
+	if r.header >= 0 {
+		for key, values := range res[r.header].Interface().(http.Header) {
+			for _, v := range values {
+				writer.Header().Add(key, v)
+			}
 		}
-		writer.Header().Add("Content-Type", "application/json")
-		_, err = writer.Write(b)
-		if err != nil {
-			return err
+	}
+
+	if r.payload == -1 {
+		// a method writing through the http.ResponseWriter defines the status itself
+		if tracked, ok := writer.(*responseWriter); !ep.raw && !(ok && tracked.written()) {
+			writer.WriteHeader(status)
+		}
+		return nil
+	}
+
+	payload := res[r.payload]
+	if isNilPayload(payload) {
+		if ep.nilCode == http.StatusNotFound {
+			return &Error{Id: IdNotFound, Message: "the requested resource does not exist"}
 		}
+
+		writer.WriteHeader(http.StatusNoContent)
+		return nil
 	}
 
-	return nil
+	switch {
+	case mediaType == MediaTypeNDJSON:
+		return writeNDJSON(srv, writer, request, status, payload)
+	case ep.payload == pkBinary:
+		return writeBinary(srv, writer, request, mediaType, status, payload.Interface())
+	case ep.payload == pkEvents:
+		return serveEvents(srv, writer, request, payload)
+	}
+
+	return writeResult(srv, writer, mediaType, status, payload.Interface())
 }
 
-func scanToType(src string, dst reflectplus.TypeDecl, dstType reflect.Type) (interface{}, error) {
-	if dst.ImportPath == "" {
-		switch dst.Identifier {
-		case "int":
-			i, err := strconv.ParseInt(src, 10, 64)
-			return int(i), err
-		case "int64":
-			i, err := strconv.ParseInt(src, 10, 64)
-			return int64(i), err
-		case "int32":
-			i, err := strconv.ParseInt(src, 10, 64)
-			return int32(i), err
-		case "byte":
-			i, err := strconv.ParseInt(src, 10, 64)
-			return byte(i), err
-		case "string":
-			return src, nil
-		case "float64":
-			i, err := strconv.ParseFloat(src, 64)
-			return i, err
-		case "bool":
-			i, err := strconv.ParseBool(src)
-			return i, err
-		default:
-			return nil, fmt.Errorf("scanToType: base type not supported: '%s' (%s)", dst.Identifier, dstType.String())
+// call invokes the method and logs its duration.
+func call(srv *Server, ep *endpoint, request *http.Request, args []reflect.Value) []reflect.Value {
+	start := time.Now()
+	res := ep.refFunc.Call(args)
+	srv.logger.Log(LevelDebug, "invoked method", "verb", request.Method, "route", routeOf(request),
+		"method", ep.method.Name, "duration", time.Since(start))
+	return res
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// scanToType converts the string into a value of the given type. Types implementing sql.Scanner or
+// encoding.TextUnmarshaler (like time.Time) convert themselves, a time.Duration is parsed by time.ParseDuration and
+// everything else is converted by its kind, so that named types like 'type Limit int' work out of the box.
+func scanToType(src string, dstType reflect.Type) (interface{}, error) {
+	val := reflect.New(dstType)
+	switch obj := val.Interface().(type) {
+	case sql.Scanner:
+		if err := obj.Scan(src); err != nil {
+			return nil, err
+		}
+		return val.Elem().Interface(), nil
+	case encoding.TextUnmarshaler:
+		if err := obj.UnmarshalText([]byte(src)); err != nil {
+			return nil, err
 		}
+		return val.Elem().Interface(), nil
 	}
-	val := reflect.New(dstType)
-	obj := val.Interface()
-	if scanner, ok := obj.(sql.Scanner); ok {
-		err := scanner.Scan(src)
-		if dstType.Kind() != reflect.Ptr {
-			obj = val.Elem().Interface()
+
+	if dstType == durationType {
+		return time.ParseDuration(src)
+	}
+
+	elem := val.Elem()
+	switch dstType.Kind() {
+	case reflect.String:
+		elem.SetString(src)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(src)
+		if err != nil {
+			return nil, err
 		}
-		return obj, err
+		elem.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(src, 10, dstType.Bits())
+		if err != nil {
+			return nil, err
+		}
+		elem.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(src, 10, dstType.Bits())
+		if err != nil {
+			return nil, err
+		}
+		elem.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(src, dstType.Bits())
+		if err != nil {
+			return nil, err
+		}
+		elem.SetFloat(f)
+	case reflect.Slice:
+		if dstType.Elem().Kind() != reflect.Uint8 {
+			return nil, fmt.Errorf("unsupported slice type: %s", dstType.String())
+		}
+		elem.SetBytes([]byte(src))
+	default:
+		return nil, fmt.Errorf("unsupported type does not implement http.Scanner or encoding.TextUnmarshaler: %s", dstType.String())
 	}
-	return nil, fmt.Errorf("unsupported type does not implement http.Scanner: %s", dstType.String())
+
+	return elem.Interface(), nil
 }
 
 func joinPaths(a, b string) string {
@@ -261,6 +459,10 @@ func httpMethods(annotations []reflectplus.Annotation) []string {
 			}
 		}
 	}
+
+	if len(res) == 0 && reflectplus.Annotations(annotations).Has(AnnotationWebSocket) {
+		res = append(res, http.MethodGet)
+	}
 	return res
 }
 
@@ -0,0 +1,107 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"fmt"
+	v3 "github.com/golangee/openapi/v3"
+	"github.com/golangee/reflectplus"
+	"reflect"
+)
+
+// converter parses request parameters into a specific type and optionally describes that type for OpenAPI.
+type converter struct {
+	parse  func(string) (interface{}, error)
+	schema *v3.Schema
+}
+
+// RegisterConverter registers a function which converts path, query, header, cookie and form values into the
+// given type. It is consulted before the built-in rules of scanToType, so it is a way to support types which
+// cannot implement Scanner or encoding.TextUnmarshaler themselves. The optional schema describes the type in
+// the OpenAPI documentation, otherwise it is documented as a string.
+func (s *Server) RegisterConverter(t reflect.Type, parse func(string) (interface{}, error), schema ...v3.Schema) {
+	c := converter{parse: parse}
+	if len(schema) > 0 {
+		c.schema = &schema[0]
+	}
+	s.converters[t] = c
+}
+
+// hasConverter returns true, if a converter has been registered for exactly the given type.
+func (s *Server) hasConverter(t reflect.Type) bool {
+	_, has := s.converters[t]
+	return has
+}
+
+// convert parses the string into the given type, either by a registered converter or by scanToType.
+func (s *Server) convert(src string, dstType reflect.Type) (reflect.Value, error) {
+	c, has := s.converters[dstType]
+	if !has {
+		v, err := scanToType(src, dstType)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(v), nil
+	}
+
+	v, err := c.parse(src)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	if v == nil {
+		return reflect.Zero(dstType), nil
+	}
+
+	if !reflect.TypeOf(v).AssignableTo(dstType) {
+		return reflect.Value{}, fmt.Errorf("converter for %s returned the incompatible type %s", dstType, reflect.TypeOf(v))
+	}
+
+	return reflect.ValueOf(v), nil
+}
+
+// converterSchema returns the OpenAPI schema of a registered converter matching the declared type, ignoring
+// pointers. Converters without an explicit schema are documented as strings.
+func (s *Server) converterSchema(decl reflectplus.TypeDecl) (v3.Schema, bool) {
+	decl.Stars = 0
+	for t, c := range s.converters {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+
+		if !isType(decl, t) {
+			continue
+		}
+
+		if c.schema != nil {
+			return *c.schema, true
+		}
+
+		return v3.Schema{Type: v3.String}, true
+	}
+
+	return v3.Schema{}, false
+}
+
+// isType returns true, if the declaration denotes the given named or builtin type.
+func isType(decl reflectplus.TypeDecl, t reflect.Type) bool {
+	stars := 0
+	for t.Kind() == reflect.Ptr && t.Name() == "" {
+		t = t.Elem()
+		stars++
+	}
+
+	return decl.Stars == stars && decl.ImportPath == t.PkgPath() && decl.Identifier == t.Name()
+}
@@ -0,0 +1,146 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"fmt"
+	"github.com/golangee/reflectplus"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// MediaTypeOctetStream is the default media type of binary payloads.
+const MediaTypeOctetStream = "application/octet-stream"
+
+// Download is a payload, which is streamed as a file. If the content implements io.ReadSeeker, Range requests are
+// supported and the length is determined by seeking.
+type Download struct {
+	Name        string    // Name is the file name for the Content-Disposition header and may be empty
+	ContentType string    // ContentType defaults to the type of the file name extension or application/octet-stream
+	Length      int64     // Length is the size in bytes, if known and positive
+	ModTime     time.Time // ModTime is used for Last-Modified and If-Modified-Since, if not zero
+	Inline      bool      // Inline asks to display the content instead of saving it
+	Content     io.Reader // Content is closed after streaming, if it implements io.Closer
+}
+
+// isBinaryPayload returns true, if the declared type is streamed as is, instead of being encoded.
+func isBinaryPayload(decl reflectplus.TypeDecl) bool {
+	switch {
+	case decl.ImportPath == "io" && (decl.Identifier == "Reader" || decl.Identifier == "ReadCloser"):
+		return decl.Stars == 0
+	case decl.ImportPath == "" && decl.Identifier == "[]":
+		return len(decl.Params) == 1 && decl.Params[0].ImportPath == "" && decl.Params[0].Identifier == "byte"
+	case decl.ImportPath == pkgPath && decl.Identifier == "Download":
+		return decl.Stars <= 1
+	default:
+		return false
+	}
+}
+
+// writeBinary streams a []byte, io.Reader or Download.
+func writeBinary(srv *Server, writer http.ResponseWriter, request *http.Request, mediaType string, status int, payload interface{}) error {
+	if len(writer.Header().Get("Content-Type")) == 0 {
+		writer.Header().Set("Content-Type", mediaType)
+	}
+
+	switch p := payload.(type) {
+	case Download:
+		serveDownload(srv, writer, request, p)
+	case *Download:
+		serveDownload(srv, writer, request, *p)
+	case []byte:
+		writer.Header().Set("Content-Length", strconv.Itoa(len(p)))
+		writer.WriteHeader(status)
+		if _, err := writer.Write(p); err != nil {
+			srv.logAborted(request, err)
+		}
+	case io.Reader:
+		if closer, ok := p.(io.Closer); ok {
+			defer closer.Close()
+		}
+
+		writer.WriteHeader(status)
+		if _, err := io.Copy(writer, p); err != nil {
+			srv.logAborted(request, err)
+		}
+	default:
+		return fmt.Errorf("unsupported binary payload %T", payload)
+	}
+
+	return nil
+}
+
+// serveDownload streams the content, using http.ServeContent if possible.
+func serveDownload(srv *Server, writer http.ResponseWriter, request *http.Request, d Download) {
+	if closer, ok := d.Content.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	header := writer.Header()
+	contentType := d.ContentType
+	if len(contentType) == 0 {
+		contentType = mime.TypeByExtension(filepath.Ext(d.Name))
+	}
+
+	if len(contentType) == 0 {
+		contentType = MediaTypeOctetStream
+	}
+	header.Set("Content-Type", contentType)
+
+	disposition := "attachment"
+	if d.Inline {
+		disposition = "inline"
+	}
+
+	if len(d.Name) > 0 {
+		if withName := mime.FormatMediaType(disposition, map[string]string{"filename": d.Name}); len(withName) > 0 {
+			disposition = withName
+		}
+	}
+	header.Set("Content-Disposition", disposition)
+
+	if d.Content == nil {
+		header.Set("Content-Length", "0")
+		writer.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if seeker, ok := d.Content.(io.ReadSeeker); ok {
+		http.ServeContent(writer, request, d.Name, d.ModTime, seeker)
+		return
+	}
+
+	if !d.ModTime.IsZero() {
+		header.Set("Last-Modified", d.ModTime.UTC().Format(http.TimeFormat))
+		if since, err := http.ParseTime(request.Header.Get("If-Modified-Since")); err == nil && !d.ModTime.Truncate(time.Second).After(since) {
+			header.Del("Content-Type")
+			writer.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	if d.Length > 0 {
+		header.Set("Content-Length", strconv.FormatInt(d.Length, 10))
+	}
+
+	writer.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(writer, d.Content); err != nil {
+		srv.logAborted(request, err)
+	}
+}
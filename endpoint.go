@@ -0,0 +1,297 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"fmt"
+	"github.com/golangee/reflectplus"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type payloadKind int
+
+const (
+	pkEncoded   payloadKind = 0 // pkEncoded payloads are encoded by the negotiated codec
+	pkBinary                = 1 // pkBinary payloads are streamed as is
+	pkEvents                = 2 // pkEvents are sent from a channel or an *EventStream as server-sent events or NDJSON
+	pkWebSocket             = 3 // pkWebSocket messages are exchanged through the upgraded connection
+	pkIterator              = 4 // pkIterator payloads yield their elements, which are streamed as NDJSON
+)
+
+// endpoint bundles the meta data of a routed controller method.
+type endpoint struct {
+	method   reflectplus.Method
+	refFunc  reflect.Value // refFunc is only valid for actual controllers and not when generating documentation
+	params   []methodParam
+	consumes []string // consumes contains the accepted media types of the request body, if it has any
+	produces []string // produces contains the offered media types of the response
+	status   int      // status is the declared status code of a successful call
+	results  results
+	nilCode  int // nilCode is either http.StatusNoContent or http.StatusNotFound for nil payloads
+	payload  payloadKind
+	raw      bool // raw is true, if the method writes the response itself through an injected http.ResponseWriter
+}
+
+// results describes the roles of the return values of a method by their index, which is -1 if absent.
+type results struct {
+	payload int // payload is the single value which is encoded as response body
+	status  int // status is an int companion, which overrides the status code if not 0
+	header  int // header is a http.Header companion, whose values are added to the response headers
+	err     int // err is the error, which must be the last value
+}
+
+// scanResults defines the roles of the return values. The first value is the payload, which may be followed by an
+// int status and a http.Header. An error must always be the last value. Everything else is ambiguous.
+func scanResults(returns []reflectplus.Param) (results, error) {
+	r := results{payload: -1, status: -1, header: -1, err: -1}
+	for i, p := range returns {
+		t := p.Type
+		switch {
+		case t.ImportPath == "" && t.Identifier == "error":
+			if i != len(returns)-1 {
+				return r, fmt.Errorf("the error must be the last return value")
+			}
+			r.err = i
+		case i == 0:
+			r.payload = i
+		case r.payload == 0 && r.status == -1 && r.header == -1 && t.ImportPath == "" && t.Identifier == "int" && t.Stars == 0:
+			r.status = i
+		case r.payload == 0 && r.header == -1 && t.ImportPath == "net/http" && t.Identifier == "Header" && t.Stars == 0:
+			r.header = i
+		default:
+			return r, fmt.Errorf("the return value %d is ambiguous: only a single payload, optionally followed by an int status, a http.Header and an error is allowed", i)
+		}
+	}
+	return r, nil
+}
+
+// isNilPayload returns true, if the payload is a nil pointer, map, channel or interface. Nil slices are encoded as
+// usual.
+func isNilPayload(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Chan, reflect.Interface:
+		return v.IsNil()
+	default:
+		return false
+	}
+}
+
+// isNilable returns true, if the declared type is a pointer, map or channel, which is treated as nil payload.
+func isNilable(decl reflectplus.TypeDecl) bool {
+	return decl.Stars > 0 || (decl.ImportPath == "" && decl.Identifier == "map") || isChanPayload(decl)
+}
+
+// newEndpoint validates the annotated method and collects its meta data.
+func newEndpoint(srv *Server, parent reflectplus.Struct, method reflectplus.Method) (*endpoint, error) {
+	methodParams, err := scanMethodParams(srv, parent, method)
+	if err != nil {
+		return nil, err
+	}
+
+	ep := &endpoint{method: method, params: methodParams, status: http.StatusOK}
+
+	ep.results, err = scanResults(method.Returns)
+	if err != nil {
+		return nil, err
+	}
+
+	if ep.results.payload == -1 {
+		ep.status = http.StatusNoContent
+	}
+
+	if a := method.GetAnnotations().FindFirst(AnnotationStatus); a != nil {
+		status, err := strconv.Atoi(a.Value())
+		if err != nil || status < 100 || status > 599 {
+			return nil, fmt.Errorf("value of '%s' must be a valid http status code but is '%s'", AnnotationStatus, a.Value())
+		}
+		ep.status = status
+	}
+
+	hasEventStream, hasWebSocket := false, false
+	for _, p := range methodParams {
+		hasEventStream = hasEventStream || p.paramType == ptEventStream
+		hasWebSocket = hasWebSocket || p.paramType == ptWebSocket
+		ep.raw = ep.raw || p.paramType == ptResponseWriter
+	}
+
+	isWebSocket := method.GetAnnotations().Has(AnnotationWebSocket)
+	if isWebSocket != hasWebSocket {
+		return nil, fmt.Errorf("a method must be annotated with '%s' if and only if it has a WebSocket parameter", AnnotationWebSocket)
+	}
+
+	switch {
+	case isWebSocket:
+		if ep.results.payload >= 0 {
+			return nil, fmt.Errorf("a method with a WebSocket parameter must not return a payload")
+		}
+
+		for _, verb := range httpMethods(method.Annotations) {
+			if verb != http.MethodGet {
+				return nil, fmt.Errorf("a websocket must be requested by GET but is declared as '%s'", verb)
+			}
+		}
+
+		ep.payload = pkWebSocket
+		ep.status = http.StatusSwitchingProtocols
+	case hasEventStream:
+		if ep.results.payload >= 0 {
+			return nil, fmt.Errorf("a method with an EventStream parameter must not return a payload")
+		}
+		ep.payload = pkEvents
+	case ep.results.payload == -1:
+	case isBinaryPayload(method.Returns[ep.results.payload].Type):
+		ep.payload = pkBinary
+	case isChanPayload(method.Returns[ep.results.payload].Type):
+		ep.payload = pkEvents
+	case isIteratorPayload(method.Returns[ep.results.payload].Type):
+		ep.payload = pkIterator
+	}
+
+	streamable := ep.results.payload >= 0 && (isSlicePayload(method.Returns[ep.results.payload].Type) ||
+		ep.payload == pkEvents || ep.payload == pkIterator)
+
+	ep.produces = mediaTypeAnnotations(method.Annotations, AnnotationProduces)
+	switch {
+	case ep.payload == pkWebSocket:
+		ep.produces = nil // messages are exchanged through the websocket
+	case len(ep.produces) > 0:
+	case ep.results.payload == -1:
+		// nothing is encoded, so there is nothing to offer
+	case ep.raw && ep.payload == pkEncoded:
+		ep.produces = srv.mediaTypes()[:1] // the method has taken over the response, so its payload is not negotiated
+	case ep.payload == pkBinary:
+		ep.produces = []string{MediaTypeOctetStream}
+	case ep.payload == pkEvents:
+		ep.produces = []string{MediaTypeEventStream}
+		if streamable {
+			ep.produces = append(ep.produces, MediaTypeNDJSON)
+		}
+	case ep.payload == pkIterator:
+		ep.produces = []string{MediaTypeNDJSON}
+	default:
+		ep.produces = srv.mediaTypes()
+		if streamable {
+			ep.produces = append(ep.produces, MediaTypeNDJSON)
+		}
+	}
+
+	for _, mediaType := range ep.produces {
+		if mediaType == MediaTypeNDJSON {
+			if !streamable {
+				return nil, fmt.Errorf("only slices, channels and iterators can be streamed as '%s'", mediaType)
+			}
+			continue
+		}
+
+		if ep.payload == pkEncoded && srv.codec(mediaType) == nil {
+			return nil, fmt.Errorf("no codec has been registered for the produced media type '%s'", mediaType)
+		}
+
+		if ep.payload == pkEvents && mediaType != MediaTypeEventStream {
+			return nil, fmt.Errorf("events cannot be sent as the produced media type '%s'", mediaType)
+		}
+
+		if ep.payload == pkIterator {
+			return nil, fmt.Errorf("iterators can only be streamed as '%s'", MediaTypeNDJSON)
+		}
+	}
+
+	ep.nilCode = http.StatusNoContent
+	if a := method.GetAnnotations().FindFirst(AnnotationNilStatus); a != nil {
+		switch a.Value() {
+		case "204":
+		case "404":
+			ep.nilCode = http.StatusNotFound
+		default:
+			return nil, fmt.Errorf("value of '%s' must be either 204 or 404 but is '%s'", AnnotationNilStatus, a.Value())
+		}
+	}
+
+	hasBody, hasForm := false, false
+	for _, p := range methodParams {
+		hasBody = hasBody || p.paramType == ptBody
+		hasForm = hasForm || p.paramType == ptForm
+	}
+
+	ep.consumes = mediaTypeAnnotations(method.Annotations, AnnotationConsumes)
+	if len(ep.consumes) == 0 {
+		switch {
+		case hasBody:
+			ep.consumes = append(srv.mediaTypes(), MediaTypeForm)
+		case hasForm:
+			ep.consumes = []string{MediaTypeForm, MediaTypeMultipartForm}
+		}
+	}
+
+	for _, mediaType := range ep.consumes {
+		isForm := mediaType == MediaTypeForm || mediaType == MediaTypeMultipartForm
+		if hasForm && !isForm {
+			return nil, fmt.Errorf("form parameters cannot be read from the consumed media type '%s'", mediaType)
+		}
+
+		// a body can be decoded from an url encoded form without a codec, but a multipart form only by form parameters
+		noCodec := isForm && (!hasBody || mediaType == MediaTypeForm)
+		if !noCodec && srv.codec(mediaType) == nil {
+			return nil, fmt.Errorf("no codec has been registered for the consumed media type '%s'", mediaType)
+		}
+	}
+
+	return ep, nil
+}
+
+// contentType returns the media type of the request body, which must be consumed by the endpoint. A missing
+// Content-Type is treated as the first consumed media type.
+func (e *endpoint) contentType(request *http.Request) (string, error) {
+	header := request.Header.Get("Content-Type")
+	if len(header) == 0 {
+		return e.consumes[0], nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err == nil {
+		for _, consumed := range e.consumes {
+			if consumed == mediaType {
+				return mediaType, nil
+			}
+		}
+	}
+
+	return "", &Error{
+		Id:      IdUnsupportedMediaType,
+		Message: fmt.Sprintf("the media type '%s' is not supported", header),
+		Details: map[string]interface{}{
+			"contentType": header,
+			"supported":   e.consumes,
+		},
+	}
+}
+
+// mediaTypeAnnotations returns the comma separated media types of all annotations with the given name.
+func mediaTypeAnnotations(annotations []reflectplus.Annotation, name string) []string {
+	var res []string
+	for _, a := range reflectplus.Annotations(annotations).FindAll(name) {
+		for _, mediaType := range strings.Split(a.Value(), ",") {
+			mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+			if len(mediaType) > 0 {
+				res = append(res, mediaType)
+			}
+		}
+	}
+	return res
+}
@@ -8,6 +8,31 @@ import (
 	"reflect"
 )
 
+// IdBodyInvalid is the Error.Id used if the request body cannot be decoded into the body parameter.
+const IdBodyInvalid = "ee.http.body.invalid"
+
+// IdParamMissing is the Error.Id used if a required request parameter is absent.
+const IdParamMissing = "ee.http.param.missing"
+
+// IdParamInvalid is the Error.Id used if a request parameter cannot be converted into the parameters type.
+const IdParamInvalid = "ee.http.param.invalid"
+
+// IdValidation is the Error.Id used if bound parameters violate their validation rules. The details contain the
+// list of all violations.
+const IdValidation = "ee.http.validation"
+
+// IdNotAcceptable is the Error.Id used if none of the media types in the Accept header can be produced.
+const IdNotAcceptable = "ee.http.not.acceptable"
+
+// IdUnsupportedMediaType is the Error.Id used if the Content-Type of the request body is not accepted.
+const IdUnsupportedMediaType = "ee.http.unsupported.media.type"
+
+// IdNotFound is the Error.Id used if a method, which declares the status 404 for nil, returns a nil payload.
+const IdNotFound = "ee.http.not.found"
+
+// IdPanic is the Error.Id used if a handler panics.
+const IdPanic = "ee.http.panic"
+
 // Error describes a (nested) server error
 type Error struct {
 	Id               string      `json:"id"`                         // Id is unique for a specific error, e.g. mydomain.not.assigned
@@ -16,6 +41,9 @@ type Error struct {
 	CausedBy         *Error      `json:"causedBy,omitempty"`         // CausedBy returns an optional root error
 	Type             string      `json:"type,omitempty"`             // Type is a developer notice for the internal inspection
 	Details          interface{} `json:"details,omitempty"`          // Details contains arbitrary payload
+	CorrelationId    string      `json:"correlationId,omitempty"`    // CorrelationId refers to the logged error, if parts are hidden
+	cause            error       // cause is the original error, so that errors.Is and errors.As can still inspect it
+	internalId       bool        // internalId is true, if the Id is the Go type name of an error without ID()
 }
 
 // WrapError takes the cause and converts it into an Error for later serialization.
@@ -24,10 +52,10 @@ func WrapError(id string, causedBy error) *Error {
 	if causedBy != nil {
 		msg = causedBy.Error()
 	}
-	return &Error{Id: id, Message: msg, CausedBy: AsError(causedBy)}
+	return &Error{Id: id, Message: msg, CausedBy: AsError(causedBy), cause: causedBy}
 }
 
-// ParseError tries to parse the response as json. In any case it returns an error.
+// ParseError tries to parse the response as json, either as Error or as Problem. In any case it returns an error.
 func ParseError(reader io.Reader) *Error {
 	buf, err := ioutil.ReadAll(reader)
 	if err != nil {
@@ -40,6 +68,14 @@ func ParseError(reader io.Reader) *Error {
 		return AsError(err)
 	}
 
+	// an Error always has an id, whereas a Problem carries it as its type
+	if len(res.Id) == 0 {
+		problem := Problem{}
+		if err := json.Unmarshal(buf, &problem); err == nil && len(problem.Type) > 0 {
+			return problem.ToError()
+		}
+	}
+
 	return res
 }
 
@@ -68,8 +104,12 @@ func (c *Error) Payload() interface{} {
 	return c.Details
 }
 
-// Unwrap returns the cause or nil
+// Unwrap returns the original cause, if the Error has been converted from a Go error, otherwise the CausedBy or nil
 func (c *Error) Unwrap() error {
+	if c.cause != nil {
+		return c.cause
+	}
+
 	if c.CausedBy == nil { // otherwise error iface will not be nil, because of the type info in interface
 		return nil
 	}
@@ -113,7 +153,7 @@ func AsError(err error) *Error {
 		return e
 	}
 
-	e := &Error{}
+	e := &Error{cause: err}
 	e.Type = reflect.TypeOf(err).String()
 	e.Message = err.Error()
 
@@ -121,6 +161,7 @@ func AsError(err error) *Error {
 		e.Id = code.ID()
 	} else {
 		e.Id = e.Type
+		e.internalId = true
 	}
 
 	if details, ok := err.(interface{ Payload() interface{} }); ok {
@@ -0,0 +1,275 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/golangee/reflectplus"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MediaTypeEventStream is the media type of server-sent events, which is produced by methods returning a
+// receive-only channel or declaring an *EventStream parameter.
+const MediaTypeEventStream = "text/event-stream"
+
+// defaultEventKeepAlive is short enough to survive the idle timeouts of common proxies.
+const defaultEventKeepAlive = 15 * time.Second
+
+// Event is a single server-sent event. Channel elements, which are not an Event, are sent as its Data.
+type Event struct {
+	Id    string        // Id is sent back by the client as Last-Event-ID when reconnecting, if not empty
+	Name  string        // Name is the event type, which is "message" on the client side if empty
+	Data  interface{}   // Data is sent as is, if it is a string or []byte, and otherwise encoded as JSON
+	Retry time.Duration // Retry tells the client how long to wait before reconnecting, if not 0
+}
+
+// EventStream sends server-sent events. A method may declare an *EventStream parameter to send events
+// imperatively, instead of returning a channel. In that case, the method must not return a payload but may
+// return an error, as long as no event has been sent. The stream is opened by the first call to Send or Open and
+// ends when the method returns. If the method returns without opening the stream, the client receives
+// 204 No Content, which tells an EventSource not to reconnect.
+type EventStream struct {
+	mutex     sync.Mutex
+	writer    http.ResponseWriter
+	request   *http.Request
+	keepAlive time.Duration
+	opened    bool
+	closed    bool
+	done      chan struct{}
+}
+
+func newEventStream(writer http.ResponseWriter, request *http.Request, keepAlive time.Duration) *EventStream {
+	return &EventStream{writer: writer, request: request, keepAlive: keepAlive}
+}
+
+// LastEventID returns the id of the last event, which the client has received before reconnecting, if any.
+func (s *EventStream) LastEventID() string {
+	return s.request.Header.Get("Last-Event-ID")
+}
+
+// Context returns the context of the request, which is cancelled when the client disconnects.
+func (s *EventStream) Context() context.Context {
+	return s.request.Context()
+}
+
+// Open writes the header of the stream, if not yet done, and starts sending keep-alive comments.
+func (s *EventStream) Open() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.open()
+}
+
+// Send writes and flushes the event. It fails, if the client has disconnected or the stream has been closed.
+func (s *EventStream) Send(event Event) error {
+	data, err := eventData(event.Data)
+	if err != nil {
+		return err
+	}
+
+	sb := &strings.Builder{}
+	if len(event.Id) > 0 {
+		sb.WriteString("id: " + singleLine(event.Id) + "\n")
+	}
+
+	if len(event.Name) > 0 {
+		sb.WriteString("event: " + singleLine(event.Name) + "\n")
+	}
+
+	if event.Retry > 0 {
+		sb.WriteString("retry: " + strconv.FormatInt(event.Retry.Milliseconds(), 10) + "\n")
+	}
+
+	data = strings.ReplaceAll(strings.ReplaceAll(data, "\r\n", "\n"), "\r", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		sb.WriteString("data: " + line + "\n")
+	}
+	sb.WriteString("\n")
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	return s.write(sb.String())
+}
+
+// open must be called with the lock held.
+func (s *EventStream) open() error {
+	if s.closed {
+		return fmt.Errorf("the event stream has been closed")
+	}
+
+	if s.opened {
+		return nil
+	}
+
+	if !canFlush(s.writer) {
+		return fmt.Errorf("the response writer does not support flushing: %T", s.writer)
+	}
+
+	header := s.writer.Header()
+	header.Set("Content-Type", MediaTypeEventStream)
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no") // disables the response buffering of nginx
+	s.writer.WriteHeader(http.StatusOK)
+	s.writer.(http.Flusher).Flush()
+	s.opened = true
+
+	if s.keepAlive > 0 {
+		s.done = make(chan struct{})
+		go s.sendKeepAlive(s.done)
+	}
+
+	return nil
+}
+
+// write must be called with the lock held.
+func (s *EventStream) write(text string) error {
+	if err := s.request.Context().Err(); err != nil {
+		return err
+	}
+
+	if _, err := s.writer.Write([]byte(text)); err != nil {
+		return err
+	}
+
+	s.writer.(http.Flusher).Flush()
+	return nil
+}
+
+// sendKeepAlive writes a comment in each interval, until done is closed.
+func (s *EventStream) sendKeepAlive(done chan struct{}) {
+	ticker := time.NewTicker(s.keepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-s.request.Context().Done():
+			return
+		case <-ticker.C:
+			s.mutex.Lock()
+			if !s.closed {
+				_ = s.write(": keep-alive\n\n")
+			}
+			s.mutex.Unlock()
+		}
+	}
+}
+
+// close stops the stream, so that nothing is written after the handler returned. It returns true, if the stream
+// has been opened before.
+func (s *EventStream) close() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.closed = true
+	if s.done != nil {
+		close(s.done)
+		s.done = nil
+	}
+	return s.opened
+}
+
+// SetEventKeepAlive sets the interval of the comments, which keep idle event streams open through proxies. Zero
+// disables them. The default is 15 seconds.
+func (s *Server) SetEventKeepAlive(interval time.Duration) {
+	s.eventKeepAlive = interval
+}
+
+// serveEvents sends each element of the channel as an event, until the channel is closed or the client has
+// disconnected.
+func serveEvents(srv *Server, writer http.ResponseWriter, request *http.Request, ch reflect.Value) error {
+	stream := newEventStream(writer, request, srv.eventKeepAlive)
+	defer stream.close()
+
+	if err := stream.Open(); err != nil {
+		return err
+	}
+
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(request.Context().Done())},
+		{Dir: reflect.SelectRecv, Chan: ch},
+	}
+
+	for {
+		chosen, value, ok := reflect.Select(cases)
+		if chosen == 0 || !ok {
+			return nil
+		}
+
+		if err := stream.Send(toEvent(value.Interface())); err != nil {
+			srv.logAborted(request, err)
+			return nil
+		}
+	}
+}
+
+// toEvent wraps the channel element into an Event, if required.
+func toEvent(v interface{}) Event {
+	switch e := v.(type) {
+	case Event:
+		return e
+	case *Event:
+		if e != nil {
+			return *e
+		}
+	}
+	return Event{Data: v}
+}
+
+// eventData returns the text representation of the event data.
+func eventData(v interface{}) (string, error) {
+	switch d := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return d, nil
+	case []byte:
+		return string(d), nil
+	default:
+		buf, err := json.Marshal(d)
+		if err != nil {
+			return "", err
+		}
+		return string(buf), nil
+	}
+}
+
+// singleLine removes line breaks, which would corrupt an event field.
+func singleLine(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+// isChanPayload returns true, if the declared type is a channel, whose elements are sent as events.
+func isChanPayload(decl reflectplus.TypeDecl) bool {
+	return decl.ImportPath == "" && strings.Contains(decl.Identifier, "chan") && len(decl.Params) == 1
+}
+
+// isEventStreamParam returns true, if the declared type is an *EventStream.
+func isEventStreamParam(decl reflectplus.TypeDecl) bool {
+	return decl.ImportPath == pkgPath && decl.Identifier == "EventStream" && decl.Stars == 1
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// HeaderRequestId is the header, which carries the correlation id of a request. An id sent by the client or a
+// proxy is reused, otherwise a random one is generated.
+const HeaderRequestId = "X-Request-Id"
+
+// IdInternal is the public Error.Id of errors without an id of their own, whose Go type name must not be exposed by
+// ExposePublic.
+const IdInternal = "ee.http.internal"
+
+// ErrorExposure defines how much of an error is rendered to the client.
+type ErrorExposure int
+
+const (
+	// ExposeAll renders the entire error chain including messages, Go types and causes, which is the default and
+	// only suited for development.
+	ExposeAll ErrorExposure = 0
+
+	// ExposePublic renders only the Id, the LocalizedMessage, the Details of allow-listed ids and a correlation id,
+	// which is also sent as HeaderRequestId. The entire error is logged together with the correlation id.
+	ExposePublic ErrorExposure = 1
+)
+
+// defaultPublicDetails are the ids of this package, whose details only describe the request.
+var defaultPublicDetails = []string{
+	IdParamMissing,
+	IdParamInvalid,
+	IdValidation,
+	IdNotAcceptable,
+	IdUnsupportedMediaType,
+}
+
+// SetErrorExposure defines how much of an error is rendered to the client.
+func (s *Server) SetErrorExposure(exposure ErrorExposure) {
+	s.errorExposure = exposure
+}
+
+// AllowErrorDetails declares the details of the errors with the given ids as safe for ExposePublic. By default,
+// the details of the binding and validation errors of this package are allowed.
+func (s *Server) AllowErrorDetails(ids ...string) {
+	for _, id := range ids {
+		s.publicDetails[id] = true
+	}
+}
+
+// expose returns the error which may be rendered to the client according to the exposure and its correlation id,
+// which is empty for ExposeAll.
+func (s *Server) expose(err *Error, request *http.Request) (*Error, string) {
+	if s.errorExposure == ExposeAll {
+		return err, ""
+	}
+
+	res := &Error{
+		Id:               err.Id,
+		LocalizedMessage: err.LocalizedMessage,
+		CorrelationId:    correlationId(request),
+	}
+
+	if err.internalId {
+		res.Id = IdInternal
+	}
+
+	if s.publicDetails[err.Id] {
+		res.Details = err.Details
+	}
+
+	return res, res.CorrelationId
+}
+
+// correlationId returns the HeaderRequestId of the request, if it is reasonable, or a new random id.
+func correlationId(request *http.Request) string {
+	if id := request.Header.Get(HeaderRequestId); len(id) > 0 && len(id) <= 128 && isPrintableASCII(id) {
+		return id
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err) // the system is broken, if there is no randomness left
+	}
+	return hex.EncodeToString(buf)
+}
+
+func isPrintableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7E {
+			return false
+		}
+	}
+	return true
+}
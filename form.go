@@ -0,0 +1,116 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"fmt"
+	"github.com/golangee/reflectplus"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// maxFormMemory is the amount of bytes of a multipart form which are kept in memory, the rest is stored on disk.
+const maxFormMemory = 32 << 20
+
+var (
+	fileHeaderType = reflect.TypeOf((*multipart.FileHeader)(nil))
+	readerType     = reflect.TypeOf((*io.Reader)(nil)).Elem()
+)
+
+// parseForm parses either an url encoded or a multipart form. It can be called multiple times.
+func parseForm(request *http.Request) error {
+	err := request.ParseMultipartForm(maxFormMemory)
+	if err == http.ErrNotMultipart {
+		return nil // the url encoded form has already been parsed
+	}
+	return err
+}
+
+// formFile returns the first file of the multipart form with the given name or nil.
+func formFile(request *http.Request, name string) *multipart.FileHeader {
+	if request.MultipartForm == nil {
+		return nil
+	}
+
+	files := request.MultipartForm.File[name]
+	if len(files) == 0 {
+		return nil
+	}
+
+	return files[0]
+}
+
+// decodeForm decodes an url encoded form into the pointer dst, which either refers to a map with string keys or to a
+// struct, whose exported fields are matched case-insensitive by name. The values are converted like form parameters.
+func decodeForm(srv *Server, request *http.Request, dst reflect.Value) error {
+	if err := request.ParseForm(); err != nil {
+		return WrapError(IdBodyInvalid, err)
+	}
+
+	v := dst.Elem()
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	for key, values := range request.PostForm {
+		p := methodParam{paramType: ptForm, param: reflectplus.Param{Name: key}, style: styleMulti}
+		switch v.Kind() {
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return fmt.Errorf("cannot decode a form into a map with %s keys", v.Type().Key())
+			}
+
+			if v.IsNil() {
+				v.Set(reflect.MakeMap(v.Type()))
+			}
+
+			value, err := bindValues(srv, values, p, v.Type().Elem())
+			if err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), value)
+		case reflect.Struct:
+			field := v.FieldByNameFunc(func(name string) bool {
+				return strings.EqualFold(name, key)
+			})
+
+			if !field.IsValid() || !field.CanSet() {
+				continue
+			}
+
+			value, err := bindValues(srv, values, p, field.Type())
+			if err != nil {
+				return err
+			}
+			field.Set(value)
+		default:
+			return fmt.Errorf("cannot decode a form into %s", v.Type())
+		}
+	}
+
+	return nil
+}
+
+// isFileParam returns true, if the declared type is bound to a file part of a multipart form.
+func isFileParam(decl reflectplus.TypeDecl) bool {
+	return (decl.ImportPath == "mime/multipart" && decl.Identifier == "FileHeader" && decl.Stars == 1) ||
+		(decl.ImportPath == "io" && decl.Identifier == "Reader" && decl.Stars == 0)
+}
@@ -0,0 +1,63 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"fmt"
+	"github.com/golangee/reflectplus"
+	"net/http"
+	"reflect"
+)
+
+// RegisterInjector registers a function which resolves a value of the given type per request, e.g. the
+// authenticated principal, a tenant, a logger or a transaction. Controller methods can declare parameters of that
+// type without any annotation, just like a context.Context. An error of the injector is returned as is, instead of
+// invoking the method. Injectors must be registered before the controllers are created.
+func (s *Server) RegisterInjector(t reflect.Type, inject func(*http.Request) (interface{}, error)) {
+	s.injectors[t] = inject
+}
+
+// isInjectable returns true, if an injector has been registered for the declared type.
+func (s *Server) isInjectable(decl reflectplus.TypeDecl) bool {
+	for t := range s.injectors {
+		if isType(decl, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// inject resolves the value of the given type for the request.
+func (s *Server) inject(request *http.Request, dstType reflect.Type) (reflect.Value, error) {
+	inject, has := s.injectors[dstType]
+	if !has {
+		return reflect.Value{}, fmt.Errorf("no injector registered for %s", dstType)
+	}
+
+	v, err := inject(request)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	if v == nil {
+		return reflect.Zero(dstType), nil
+	}
+
+	if !reflect.TypeOf(v).AssignableTo(dstType) {
+		return reflect.Value{}, fmt.Errorf("injector for %s returned the incompatible type %s", dstType, reflect.TypeOf(v))
+	}
+
+	return reflect.ValueOf(v), nil
+}
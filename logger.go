@@ -0,0 +1,117 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Level is the severity of a log record.
+type Level int
+
+const (
+	LevelDebug Level = 0 // LevelDebug is used for each invoked method
+	LevelInfo  Level = 1 // LevelInfo is used for registered routes
+	LevelWarn  Level = 2 // LevelWarn is used for errors caused by the client
+	LevelError Level = 3 // LevelError is used for errors caused by the server and recovered panics
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return "LEVEL(" + strconv.Itoa(int(l)) + ")"
+	}
+}
+
+// A Logger receives structured log records. The keysAndValues alternate between a string key and its value, e.g.
+//   logger.Log(LevelInfo, "registered route", "verb", "GET", "route", "/api/v1/sms/:id")
+type Logger interface {
+	Log(level Level, msg string, keysAndValues ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Log(Level, string, ...interface{}) {}
+
+// stdLogger writes each record as a single line of key=value pairs.
+type stdLogger struct {
+	logger *log.Logger
+	min    Level
+}
+
+// NewStdLogger adapts the standard library logger, e.g. log.New(os.Stderr, "", log.LstdFlags). Records below the
+// minimum level are dropped. A nil logger writes to the standard logger of the log package.
+func NewStdLogger(logger *log.Logger, min Level) Logger {
+	if logger == nil {
+		logger = log.New(log.Writer(), log.Prefix(), log.Flags())
+	}
+	return stdLogger{logger: logger, min: min}
+}
+
+func (l stdLogger) Log(level Level, msg string, keysAndValues ...interface{}) {
+	if level < l.min {
+		return
+	}
+
+	sb := &strings.Builder{}
+	sb.WriteString(level.String())
+	sb.WriteString(" ")
+	sb.WriteString(msg)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		sb.WriteString(" ")
+		sb.WriteString(fmt.Sprint(keysAndValues[i]))
+		sb.WriteString("=")
+		if i+1 < len(keysAndValues) {
+			sb.WriteString(logValue(keysAndValues[i+1]))
+		}
+	}
+	l.logger.Print(sb.String())
+}
+
+// logValue quotes the value, if it is empty or contains spaces, quotes or control characters.
+func logValue(v interface{}) string {
+	s := fmt.Sprint(v)
+	if len(s) == 0 || strings.IndexFunc(s, func(r rune) bool { return r <= ' ' || r == '"' || r == '=' }) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// SetLogger replaces the logger, which discards everything by default. A nil logger restores the default.
+func (s *Server) SetLogger(logger Logger) {
+	if logger == nil {
+		logger = nopLogger{}
+	}
+	s.logger = logger
+}
+
+// logAborted logs an error, which occurred after the response has been started and therefore could not be
+// reported to the client anymore.
+func (s *Server) logAborted(request *http.Request, err error) {
+	s.logger.Log(LevelError, "the response has been aborted", "verb", request.Method, "route", routeOf(request),
+		"errorId", AsError(err).Id, "error", err)
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/golangee/reflectplus"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// MediaTypeNDJSON is the media type of newline delimited JSON, which is offered for slices, channels and iterators.
+// Each element is encoded and flushed as a single line, so that large results do not need to be buffered.
+const MediaTypeNDJSON = "application/x-ndjson"
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// isSlicePayload returns true, if the declared type is a slice, whose elements can be streamed.
+func isSlicePayload(decl reflectplus.TypeDecl) bool {
+	return decl.ImportPath == "" && decl.Identifier == "[]" && decl.Stars == 0
+}
+
+// isIteratorPayload returns true, if the declared type is a function. An iterator has the signature
+// func(yield func(T) error) error and must call yield for each element, until it returns an error.
+func isIteratorPayload(decl reflectplus.TypeDecl) bool {
+	return decl.ImportPath == "" && strings.HasPrefix(decl.Identifier, "func") && decl.Stars == 0
+}
+
+// isIteratorFunc checks the actual signature of an iterator.
+func isIteratorFunc(t reflect.Type) bool {
+	if t.Kind() != reflect.Func || t.NumIn() != 1 || t.NumOut() != 1 || t.Out(0) != errorType {
+		return false
+	}
+
+	yield := t.In(0)
+	return yield.Kind() == reflect.Func && yield.NumIn() == 1 && yield.NumOut() == 1 && yield.Out(0) == errorType
+}
+
+// writeNDJSON encodes each element of the slice, channel or iterator as a single line, until all elements have been
+// written or the client has disconnected.
+func writeNDJSON(srv *Server, writer http.ResponseWriter, request *http.Request, status int, payload reflect.Value) error {
+	ctx := request.Context()
+	encoder := json.NewEncoder(writer)
+	flusher, _ := writer.(http.Flusher)
+	write := func(v reflect.Value) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := encoder.Encode(v.Interface()); err != nil {
+			return err
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+
+	writer.Header().Set("Content-Type", MediaTypeNDJSON)
+	writer.Header().Set("X-Content-Type-Options", "nosniff")
+	writer.WriteHeader(status)
+
+	var err error
+	switch payload.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < payload.Len() && err == nil; i++ {
+			err = write(payload.Index(i))
+		}
+	case reflect.Chan:
+		cases := []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+			{Dir: reflect.SelectRecv, Chan: payload},
+		}
+
+		for err == nil {
+			chosen, value, ok := reflect.Select(cases)
+			if chosen == 0 || !ok {
+				break
+			}
+			err = write(value)
+		}
+	case reflect.Func:
+		yield := reflect.MakeFunc(payload.Type().In(0), func(args []reflect.Value) []reflect.Value {
+			res := reflect.New(errorType).Elem()
+			if err := write(args[0]); err != nil {
+				res.Set(reflect.ValueOf(err))
+			}
+			return []reflect.Value{res}
+		})
+
+		if res := payload.Call([]reflect.Value{yield})[0]; !res.IsNil() {
+			err = res.Interface().(error)
+		}
+	default:
+		err = fmt.Errorf("unsupported ndjson payload %s", payload.Type())
+	}
+
+	if err != nil && ctx.Err() == nil {
+		srv.logAborted(request, err)
+	}
+
+	return nil
+}
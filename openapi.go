@@ -15,15 +15,22 @@
 package http
 
 import (
-	"fmt"
 	v3 "github.com/golangee/openapi/v3"
 	"github.com/golangee/reflectplus"
+	"net/http"
 	"strconv"
 	"strings"
 )
 
-// MakeDoc tries to generate the OpenAPI documentation from all given controller structs
+// MakeDoc tries to generate the OpenAPI documentation from all given controller structs, as served by a default
+// server. Controllers which depend on registered injectors or converters must use Server.MakeDoc instead.
 func MakeDoc(doc *v3.Document, controllers []reflectplus.Struct) error {
+	return NewServer().MakeDoc(doc, controllers)
+}
+
+// MakeDoc tries to generate the OpenAPI documentation from all given controller structs, as served by this server,
+// e.g. including the schemas of the registered converters.
+func (s *Server) MakeDoc(doc *v3.Document, controllers []reflectplus.Struct) error {
 	if doc.Components == nil {
 		doc.Components = &v3.Components{}
 	}
@@ -37,7 +44,7 @@ func MakeDoc(doc *v3.Document, controllers []reflectplus.Struct) error {
 			continue
 		}
 
-		err := makeDocController(doc, ctr)
+		err := makeDocController(s, doc, ctr)
 		if err != nil {
 			return err
 		}
@@ -48,7 +55,7 @@ func MakeDoc(doc *v3.Document, controllers []reflectplus.Struct) error {
 
 // makeDocController is partially a copy paste but we want that generation without actual go types, just based on
 // our parser reflect data and not really only at runtime.
-func makeDocController(doc *v3.Document, meta reflectplus.Struct) error {
+func makeDocController(srv *Server, doc *v3.Document, meta reflectplus.Struct) error {
 	prefixRoutes := httpRoutes(meta.Annotations)
 
 	stereotypeCtr := meta.GetAnnotations().FindFirst(AnnotationStereotypeController)
@@ -74,7 +81,7 @@ func makeDocController(doc *v3.Document, meta reflectplus.Struct) error {
 			routes = append(routes, "/")
 		}
 
-		methodParams, err := scanMethodParams(meta, method)
+		ep, err := newEndpoint(srv, meta, method)
 		if err != nil {
 			return reflectplus.PositionalError(method, err)
 		}
@@ -85,7 +92,7 @@ func makeDocController(doc *v3.Document, meta reflectplus.Struct) error {
 					path := joinPaths(prefixRoute, route)
 					oasPath := pathVarsToOASPath(path)
 
-					item := newPathDoc(doc, verb, path, oaiGroupTag, method, methodParams)
+					item := newPathDoc(srv, doc, verb, path, oaiGroupTag, ep)
 
 					doc.Paths[oasPath] = item
 
@@ -104,14 +111,18 @@ func pathVarsToOASPath(path string) string {
 	})
 }
 
-func newPathDoc(doc *v3.Document, verb, path string, tag string, method reflectplus.Method, methodParams []methodParam) v3.PathItem {
+func newPathDoc(srv *Server, doc *v3.Document, verb, path string, tag string, ep *endpoint) v3.PathItem {
+	method := ep.method
 	item := v3.PathItem{}
 	op := v3.Operation{}
 	op.Tags = append(op.Tags, tag)
 	op.Summary = reflectplus.DocShortText(method.Doc)
 	op.Description = reflectplus.DocText(method.Doc)
 
-	for _, param := range methodParams {
+	formSchema := v3.Schema{Type: v3.Object, Properties: map[string]v3.Schema{}}
+	hasFormFile := false
+
+	for _, param := range expandBeans(ep.params) {
 		p := v3.Parameter{}
 		p.Name = param.Alias()
 		p.Description = paramDoc(param.param)
@@ -120,52 +131,155 @@ func newPathDoc(doc *v3.Document, verb, path string, tag string, method reflectp
 		case ptPath:
 			ignore = false
 			p.In = v3.PathLocation
-			p.Required = true
 		case ptQuery:
 			ignore = false
 			p.In = v3.QueryLocation
 		case ptHeader:
 			ignore = false
 			p.In = v3.HeaderLocation
+		case ptCookie:
+			ignore = false
+			p.In = v3.CookieLocation
+		case ptForm:
+			schema := v3.Schema{Type: v3.String, Format: "binary"}
+			if isFileParam(param.param.Type) {
+				hasFormFile = true
+			} else {
+				schema = toSchema(srv, doc, param.param.Type)
+				if param.validation != nil && schema.Ref == nil {
+					param.validation.constraints.apply(&schema)
+				}
+			}
+			schema.Description = p.Description
+			formSchema.Properties[p.Name] = schema
+		case ptBody:
+			schema := toSchema(srv, doc, param.param.Type)
+			content := map[string]v3.MediaType{}
+			for _, mediaType := range ep.consumes {
+				content[mediaType] = v3.MediaType{Schema: schema}
+			}
+
+			op.RequestBody = &v3.RequestBody{
+				Description: paramDoc(param.param),
+				Required:    true,
+				Content:     content,
+			}
 		}
 
 		if ignore {
 			continue
 		}
 
-		p.Schema = toSchema(doc, param.param.Type)
+		p.Required = param.required
+		p.Schema = toSchema(srv, doc, param.param.Type)
+		if p.Schema.Type == v3.Array {
+			p.Style, p.Explode = paramStyle(param)
+		}
+
+		if len(param.defaultValue) > 0 {
+			p.Schema.Default = schemaDefault(p.Schema, param.defaultValue)
+		}
+
+		if param.validation != nil && p.Schema.Ref == nil {
+			param.validation.constraints.apply(&p.Schema)
+		}
 
 		op.Parameters = append(op.Parameters, p)
 	}
 
-	op.Responses = map[string]v3.Response{}
-	for _, param := range method.Returns {
-		if param.Type.ImportPath == "" && param.Type.Identifier == "error" {
-			continue //TODO, how to define errors typesafe?
+	if len(formSchema.Properties) > 0 {
+		content := map[string]v3.MediaType{}
+		for _, mediaType := range ep.consumes {
+			if hasFormFile && mediaType != MediaTypeMultipartForm {
+				continue // files can only be uploaded by multipart forms
+			}
+			content[mediaType] = v3.MediaType{Schema: formSchema}
 		}
 
+		op.RequestBody = &v3.RequestBody{
+			Content: content,
+		}
+	}
+
+	op.Responses = map[string]v3.Response{}
+	if ep.payload == pkEvents && ep.results.payload == -1 {
 		op.Responses["200"] = v3.Response{
-			Description: paramDoc(param),
+			Description: "The events are sent as a stream, until the call returns or the client disconnects.",
 			Content: map[string]v3.MediaType{
-				"application/json": {Schema: toSchema(doc, param.Type)},
+				MediaTypeEventStream: {Schema: v3.Schema{Type: v3.String}},
 			},
 		}
+		op.Responses[strconv.Itoa(ep.status)] = v3.Response{
+			Description: "No content is returned, if the call returns without sending events.",
+		}
+	} else if ep.payload == pkWebSocket {
+		op.Responses[strconv.Itoa(ep.status)] = v3.Response{
+			Description: "The connection is upgraded to a WebSocket, whose messages are exchanged until the call returns.",
+		}
+		op.Responses[strconv.Itoa(http.StatusUpgradeRequired)] = v3.Response{
+			Description: "Upgrade required is returned, if the request is not a valid WebSocket handshake.",
+			Content:     errContent(srv, doc),
+		}
+	} else if ep.results.payload == -1 {
+		op.Responses[strconv.Itoa(ep.status)] = v3.Response{
+			Description: "The request has been processed successfully.",
+		}
+	} else {
+		param := method.Returns[ep.results.payload]
+		schema := v3.Schema{} // the body of a Response envelope may be anything
+		switch {
+		case ep.payload == pkBinary:
+			schema = v3.Schema{Type: v3.String, Format: "binary"}
+		case ep.payload == pkEvents:
+			schema = toSchema(srv, doc, param.Type.Params[0]) // the schema describes the data of each event
+		case ep.payload == pkIterator:
+			schema = v3.Schema{} // the element type of an iterator is not known from its declaration
+		case !(param.Type.ImportPath == pkgPath && param.Type.Identifier == "Response"):
+			schema = toSchema(srv, doc, param.Type)
+		}
 
-		op.Responses["400"] = v3.Response{
-			Description: "Bad request is usually returned, if you have missing or wrong formatted parameter.",
-			Content: map[string]v3.MediaType{
-				"application/json": {Schema: errSchema(doc)},
-			},
+		content := map[string]v3.MediaType{}
+		for _, mediaType := range ep.produces {
+			content[mediaType] = v3.MediaType{Schema: schema}
+			if mediaType == MediaTypeNDJSON && schema.Type == v3.Array && schema.Items != nil {
+				content[mediaType] = v3.MediaType{Schema: *schema.Items.Schema} // each line contains a single element
+			}
 		}
 
-		op.Responses["500"] = v3.Response{
-			Description: "Internal Server Error is usually returned, if something went wrong at the server side. " +
-				"If this problem persists, you should contact the support, to get more insight.",
-			Content: map[string]v3.MediaType{
-				"application/json": {Schema: errSchema(doc)},
-			},
+		op.Responses[strconv.Itoa(ep.status)] = v3.Response{
+			Description: paramDoc(param),
+			Content:     content,
 		}
 
+		if isNilable(param.Type) {
+			if ep.nilCode == http.StatusNotFound {
+				op.Responses["404"] = v3.Response{
+					Description: "Not found is returned, if the requested resource does not exist.",
+					Content:     errContent(srv, doc),
+				}
+			} else {
+				op.Responses["204"] = v3.Response{
+					Description: "No content is returned, if there is no result.",
+				}
+			}
+		}
+	}
+
+	if ep.results.status >= 0 {
+		op.Responses["default"] = v3.Response{
+			Description: "The status code may be defined individually per call.",
+		}
+	}
+
+	op.Responses["400"] = v3.Response{
+		Description: "Bad request is usually returned, if you have missing or wrong formatted parameter.",
+		Content:     errContent(srv, doc),
+	}
+
+	op.Responses["500"] = v3.Response{
+		Description: "Internal Server Error is usually returned, if something went wrong at the server side. " +
+			"If this problem persists, you should contact the support, to get more insight.",
+		Content: errContent(srv, doc),
 	}
 
 	switch strings.ToUpper(verb) {
@@ -185,6 +299,42 @@ func newPathDoc(doc *v3.Document, verb, path string, tag string, method reflectp
 	return item
 }
 
+// paramStyle returns the OpenAPI serialization style of an array parameter.
+func paramStyle(param methodParam) (style string, explode *bool) {
+	multi := param.style == styleMulti
+	switch param.paramType {
+	case ptHeader:
+		return "simple", &multi
+	default:
+		return "form", &multi
+	}
+}
+
+// schemaDefault converts the default value of a parameter into the type of its schema.
+func schemaDefault(schema v3.Schema, value string) interface{} {
+	switch schema.Type {
+	case v3.Integer:
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i
+		}
+	case v3.Number:
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	case v3.Boolean:
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	case v3.Array:
+		var res []interface{}
+		for _, v := range strings.Split(value, ",") {
+			res = append(res, schemaDefault(*schema.Items.Schema, strings.TrimSpace(v)))
+		}
+		return res
+	}
+	return value
+}
+
 func paramDoc(decl reflectplus.Param) string {
 	strct := reflectplus.FindStruct(decl.Type.ImportPath, decl.Type.Identifier)
 	if strct == nil && decl.Type.ImportPath == "" && decl.Type.Identifier == "[]" {
@@ -197,7 +347,79 @@ func paramDoc(decl reflectplus.Param) string {
 	return strings.TrimSpace(doc)
 }
 
-func errSchema(doc *v3.Document) v3.Schema {
+// errContent describes the rendered errors of the server.
+func errContent(srv *Server, doc *v3.Document) map[string]v3.MediaType {
+	return map[string]v3.MediaType{
+		srv.errMediaType(): {Schema: errSchema(srv, doc)},
+	}
+}
+
+// errSchema returns a reference to either the Problem or the Error schema, depending on the server.
+func errSchema(srv *Server, doc *v3.Document) v3.Schema {
+	if !srv.problemDetails {
+		return errorSchema(doc)
+	}
+
+	xtype := "github.com/golangee/http/#Problem"
+	ref := "#/components/schemas/Problem"
+	if _, ok := doc.Components.Schemas["Problem"]; !ok {
+		doc.Components.Schemas["Problem"] = v3.Schema{
+			Type: "object",
+			Properties: map[string]v3.Schema{
+				"type": {
+					Type: v3.String,
+					Description: "Type is unique per error category and can be mapped to a specific error case " +
+						"which can be solved in a distinct way.",
+				},
+				"title": {
+					Type:        v3.String,
+					Description: "Title is the text of the status code.",
+				},
+				"status": {
+					Type:        v3.Integer,
+					Format:      "int32",
+					Description: "Status is the http status code.",
+				},
+				"detail": {
+					Type: v3.String,
+					Description: "Detail helps the developer to understand what was wrong. It should never be used" +
+						" to determine which kind of error happened. Use the type instead.",
+				},
+				"instance": {
+					Type:        v3.String,
+					Description: "Instance is the path of the failed request.",
+				},
+				"localizedMessage": {
+					Type: v3.String,
+					Description: "LocalizedMessage is optional and should only be there if it is worth " +
+						"to show it to the user, because it is already translated and offers an understandable " +
+						"explanation or solution.",
+				},
+				"class": {
+					Type: v3.String,
+					Description: "Class helps the developer to understand what is wrong. It represents an " +
+						"implementation detail.",
+				},
+				"details": {
+					Type: v3.Object,
+					Description: "Details is optional and may contain arbitrary details which are unique for a " +
+						"specific error case.",
+				},
+				"causedBy": errorSchema(doc),
+				"correlationId": {
+					Type:        v3.String,
+					Description: "CorrelationId refers to the logged error, if parts of it are not exposed.",
+				},
+			},
+			Description: "Problem describes a server error as RFC 7807 document.",
+			XType:       &xtype,
+		}
+	}
+	return v3.Schema{Ref: &ref}
+}
+
+// errorSchema returns a reference to the Error schema.
+func errorSchema(doc *v3.Document) v3.Schema {
 	xtype := "github.com/golangee/http/#Error"
 	ref := "#/components/schemas/Error"
 	s, ok := doc.Components.Schemas["Error"]
@@ -233,6 +455,10 @@ func errSchema(doc *v3.Document) v3.Schema {
 						"help to solve the problem.",
 				},
 
+				"correlationId": {
+					Type:        v3.String,
+					Description: "CorrelationId refers to the logged error, if parts of it are not exposed.",
+				},
 				"causedBy": {
 					Ref: &ref,
 					Description: "CausedBy is optional and may reference another error which is the root " +
@@ -248,17 +474,21 @@ func errSchema(doc *v3.Document) v3.Schema {
 	return v3.Schema{Ref: &ref}
 }
 
-func toSchema(doc *v3.Document, decl reflectplus.TypeDecl) v3.Schema {
+func toSchema(srv *Server, doc *v3.Document, decl reflectplus.TypeDecl) v3.Schema {
+	if s, has := srv.converterSchema(decl); has {
+		return s
+	}
+
 	s := v3.Schema{}
 	switch decl.ImportPath {
 	case "":
 		switch decl.Identifier {
-		case "int32":
+		case "int8", "int16", "int32", "byte", "uint8", "uint16":
 			fallthrough
 		case "int":
 			s.Type = v3.Integer
 			s.Format = "int32"
-		case "int64":
+		case "int64", "uint", "uint32", "uint64":
 			s.Type = v3.Integer
 			s.Format = "int64"
 		case "float32":
@@ -267,27 +497,44 @@ func toSchema(doc *v3.Document, decl reflectplus.TypeDecl) v3.Schema {
 		case "float64":
 			s.Type = v3.Number
 			s.Format = "double"
+		case "bool":
+			s.Type = v3.Boolean
 		case "string":
 			s.Type = v3.String
-		case "byte":
-			s.Type = v3.String
-			s.Format = "byte" // base64 encoded
 		case "[]":
-			tmp := toSchema(doc, decl.Params[0])
+			if elem := decl.Params[0]; elem.ImportPath == "" && (elem.Identifier == "byte" || elem.Identifier == "uint8") {
+				s.Type = v3.String
+				s.Format = "byte" // base64 encoded
+				break
+			}
+
+			tmp := toSchema(srv, doc, decl.Params[0])
 			s.Type = v3.Array
 			s.Items = &v3.Items{
 				Schema: &tmp,
 			}
+		case "map":
+			s.Type = v3.Object
 		default:
 			panic("cannot emit base type " + decl.Identifier)
 		}
+	case "time":
+		s.Type = v3.String
+		switch decl.Identifier {
+		case "Time":
+			s.Format = "date-time"
+		case "Duration":
+			s.Format = "duration" // e.g. 1h30m as parsed by time.ParseDuration
+		}
 	default:
 		strct := reflectplus.FindStruct(decl.ImportPath, decl.Identifier)
 		var typeDef *reflectplus.TypeDef
 		if strct == nil {
 			typeDef = reflectplus.FindTypeDef(decl.ImportPath, decl.Identifier)
 			if typeDef == nil {
-				panic("return type must be a struct or base type but is " + fmt.Sprintf("%+v", decl))
+				// an unknown foreign type, which must be a sql.Scanner or encoding.TextUnmarshaler to be bindable
+				s.Type = v3.String
+				return s
 			}
 		}
 		if doc.Components == nil {
@@ -319,9 +566,9 @@ func toSchema(doc *v3.Document, decl reflectplus.TypeDecl) v3.Schema {
 		s.Ref = &ref
 
 		if strct != nil {
-			finishSchemaAsObj(doc, &newSpec, strct)
+			finishSchemaAsObj(srv, doc, &newSpec, strct)
 		} else {
-			finishSchemaAsTypeDef(doc, &newSpec, typeDef)
+			finishSchemaAsTypeDef(srv, doc, &newSpec, typeDef)
 		}
 
 		doc.Components.Schemas[shortId] = newSpec
@@ -330,21 +577,24 @@ func toSchema(doc *v3.Document, decl reflectplus.TypeDecl) v3.Schema {
 	return s
 }
 
-func finishSchemaAsTypeDef(doc *v3.Document, newSpec *v3.Schema, typeDef *reflectplus.TypeDef) {
-	underlyingTypeSchema := toSchema(doc, typeDef.UnderlyingType)
+func finishSchemaAsTypeDef(srv *Server, doc *v3.Document, newSpec *v3.Schema, typeDef *reflectplus.TypeDef) {
+	underlyingTypeSchema := toSchema(srv, doc, typeDef.UnderlyingType)
 	newSpec.Type = underlyingTypeSchema.Type
 	newSpec.Format = underlyingTypeSchema.Format
 	newSpec.Items = underlyingTypeSchema.Items
 	newSpec.Description = typeDef.Doc
 }
 
-func finishSchemaAsObj(doc *v3.Document, newSpec *v3.Schema, strct *reflectplus.Struct) {
+func finishSchemaAsObj(srv *Server, doc *v3.Document, newSpec *v3.Schema, strct *reflectplus.Struct) {
 	newSpec.Description = strct.Doc
 	newSpec.Type = v3.Object
 	newSpec.Properties = map[string]v3.Schema{}
 	for _, f := range strct.Fields {
-		schema := toSchema(doc, f.Type)
+		schema := toSchema(srv, doc, f.Type)
 		schema.Description = f.Doc
+		if c, err := fieldConstraints(f); err == nil && schema.Ref == nil {
+			c.apply(&schema)
+		}
 		newSpec.Properties[f.Name] = schema
 	}
 }
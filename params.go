@@ -15,9 +15,16 @@
 package http
 
 import (
+	"errors"
 	"fmt"
 	"github.com/golangee/reflectplus"
+	"go/ast"
+	"net/http"
+	"reflect"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 var regexParamNames = regexp.MustCompile(":\\w+")
@@ -34,13 +41,28 @@ const (
 	ptBody                     = 6
 	ptRequest                  = 7
 	ptResponseWriter           = 8
+	ptCookie                   = 9
+	ptBean                     = 10
+	ptInjected                 = 11
+	ptEventStream              = 12
+	ptWebSocket                = 13
+)
+
+const (
+	styleMulti = "multi" // styleMulti expects a repeated parameter per value, e.g. ?tag=a&tag=b
+	styleCSV   = "csv"   // styleCSV expects comma separated values, e.g. ?tag=a,b
 )
 
 type methodParam struct {
-	paramType paramType
-	idx       int
-	param     reflectplus.Param
-	alias     string
+	paramType    paramType
+	idx          int
+	param        reflectplus.Param
+	alias        string
+	style        string
+	required     bool
+	defaultValue string
+	fields       []methodParam // fields of a bean parameter, the param name is the field name
+	validation   *validation
 }
 
 func (m methodParam) Alias() string {
@@ -50,8 +72,41 @@ func (m methodParam) Alias() string {
 	return m.param.Name
 }
 
+// location returns the name of the request part, from which the parameter is taken.
+func (m methodParam) location() string {
+	switch m.paramType {
+	case ptPath:
+		return "path"
+	case ptQuery:
+		return "query"
+	case ptHeader:
+		return "header"
+	case ptCookie:
+		return "cookie"
+	case ptForm:
+		return "form"
+	case ptBody:
+		return "body"
+	default:
+		return "unknown"
+	}
+}
+
+// newError creates an Error with the given id which details the name and location of the parameter.
+func (m methodParam) newError(id, msg string, causedBy error) *Error {
+	return &Error{
+		Id:       id,
+		Message:  msg,
+		CausedBy: AsError(causedBy),
+		Details: map[string]interface{}{
+			"name": m.Alias(),
+			"in":   m.location(),
+		},
+	}
+}
+
 // scanMethodParams validates the annotated method and returns unified meta data about the kind of input
-func scanMethodParams(parent reflectplus.Struct, method reflectplus.Method) ([]methodParam, error) {
+func scanMethodParams(srv *Server, parent reflectplus.Struct, method reflectplus.Method) ([]methodParam, error) {
 	paramsToDefine := map[string]methodParam{}
 	for idx, p := range method.Params {
 		paramsToDefine[p.Name] = methodParam{
@@ -84,6 +139,62 @@ func scanMethodParams(parent reflectplus.Struct, method reflectplus.Method) ([]m
 			res = append(res, tmp)
 			delete(paramsToDefine, p.Name)
 		}
+
+		if isEventStreamParam(p.Type) {
+			tmp := paramsToDefine[p.Name]
+			tmp.paramType = ptEventStream
+			res = append(res, tmp)
+			delete(paramsToDefine, p.Name)
+		}
+
+		if isWebSocketParam(p.Type) {
+			tmp := paramsToDefine[p.Name]
+			tmp.paramType = ptWebSocket
+			res = append(res, tmp)
+			delete(paramsToDefine, p.Name)
+		}
+	}
+
+	// pick up the custom injection parameter
+	for _, p := range method.Params {
+		if _, has := paramsToDefine[p.Name]; has && srv.isInjectable(p.Type) {
+			tmp := paramsToDefine[p.Name]
+			tmp.paramType = ptInjected
+			res = append(res, tmp)
+			delete(paramsToDefine, p.Name)
+		}
+	}
+
+	// collect bean params, whose fields may satisfy route variables
+	beanPathParams := map[string]bool{}
+	var beanPathNames []string // beanPathNames keeps the declaration order for deterministic errors
+	for _, a := range method.GetAnnotations().FindAll(AnnotationBeanParam) {
+		name := a.Value()
+		if len(name) == 0 {
+			return nil, fmt.Errorf("value of '%s' must not be empty", AnnotationBeanParam)
+		}
+
+		if _, has := paramsToDefine[name]; !has {
+			return nil, fmt.Errorf("the bean parameter '%s' has no matching method parameter", name)
+		}
+
+		tmp := paramsToDefine[name]
+		tmp.paramType = ptBean
+		fields, err := scanBeanFields(tmp.param.Type)
+		if err != nil {
+			return nil, fmt.Errorf("the bean parameter '%s' is invalid: %w", name, err)
+		}
+
+		for _, f := range fields {
+			if f.paramType == ptPath && !beanPathParams[f.Alias()] {
+				beanPathParams[f.Alias()] = true
+				beanPathNames = append(beanPathNames, f.Alias())
+			}
+		}
+
+		tmp.fields = fields
+		res = append(res, tmp)
+		delete(paramsToDefine, name)
 	}
 
 	// collect prefix route variables from parent
@@ -95,62 +206,384 @@ func scanMethodParams(parent reflectplus.Struct, method reflectplus.Method) ([]m
 				return nil, fmt.Errorf("method has an empty route")
 			}
 
-			for _, routeParam := range paramNamesFromRoute(actualRoute) {
+			routeParams := paramNamesFromRoute(actualRoute)
+			for _, name := range beanPathNames {
+				if !containsString(routeParams, name) {
+					return nil, fmt.Errorf("the bean path parameter '%s' has no matching route variable in '%s'", name, actualRoute)
+				}
+			}
+
+			for _, routeParam := range routeParams {
+				if beanPathParams[routeParam] {
+					continue
+				}
+
 				if _, has := paramsToDefine[routeParam]; !has {
 					return nil, fmt.Errorf("the named route variable '%s' has no matching method parameter", routeParam)
 				}
 				tmp := paramsToDefine[routeParam]
 				tmp.paramType = ptPath
+				tmp.required = true
 				res = append(res, tmp)
 				delete(paramsToDefine, routeParam)
 			}
 		}
 	}
 
-	// collect query params
-	for _, a := range method.GetAnnotations().FindAll(AnnotationQueryParam) {
+	// collect query, header, cookie and form params
+	for _, named := range []struct {
+		annotation string
+		paramType  paramType
+		kind       string
+	}{
+		{AnnotationQueryParam, ptQuery, "query"},
+		{AnnotationHeaderParam, ptHeader, "header"},
+		{AnnotationCookieParam, ptCookie, "cookie"},
+		{AnnotationFormParam, ptForm, "form"},
+	} {
+		params, err := collectNamedParams(method, paramsToDefine, named.annotation, named.paramType, named.kind)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, params...)
+	}
+
+	// collect the body param
+	bodyParams := method.GetAnnotations().FindAll(AnnotationBodyParam)
+	if len(bodyParams) > 1 {
+		return nil, fmt.Errorf("only a single '%s' is allowed", AnnotationBodyParam)
+	}
+
+	for _, a := range bodyParams {
 		name := a.Value()
 		if len(name) == 0 {
-			return nil, fmt.Errorf("value of '%s' must not be empty", AnnotationQueryParam)
+			return nil, fmt.Errorf("value of '%s' must not be empty", AnnotationBodyParam)
 		}
 
 		if _, has := paramsToDefine[name]; !has {
-			return nil, fmt.Errorf("the query parameter '%s' has no matching method parameter", name)
+			return nil, fmt.Errorf("the body parameter '%s' has no matching method parameter", name)
 		}
 
 		tmp := paramsToDefine[name]
-		tmp.alias = a.AsString("alias")
-		tmp.paramType = ptQuery
+		tmp.paramType = ptBody
 		res = append(res, tmp)
 		delete(paramsToDefine, name)
 	}
 
-	// collect header params
-	for _, a := range method.GetAnnotations().FindAll(AnnotationHeaderParam) {
+	if len(bodyParams) > 0 && method.GetAnnotations().Has(AnnotationFormParam) {
+		return nil, fmt.Errorf("'%s' and '%s' are mutually exclusive", AnnotationBodyParam, AnnotationFormParam)
+	}
+
+	// check for parameters, which have not been defined yet
+	for _, p := range paramsToDefine {
+		return nil, fmt.Errorf("method parameter '%s' has not been mapped to a request parameter", p.param.Name)
+	}
+
+	// collect the validation rules of all bound params
+	paramConstraints := map[string]constraints{}
+	for _, a := range method.GetAnnotations().FindAll(AnnotationValidate) {
+		c, err := parseConstraints(a)
+		if err != nil {
+			return nil, err
+		}
+		paramConstraints[a.Value()] = c
+	}
+
+	for i, p := range res {
+		if p.paramType == ptCtx || p.paramType == ptRequest || p.paramType == ptResponseWriter || p.paramType == ptInjected ||
+			p.paramType == ptEventStream || p.paramType == ptWebSocket {
+			continue
+		}
+
+		c, has := paramConstraints[p.param.Name]
+		delete(paramConstraints, p.param.Name)
+		v, err := newValidation(p.param.Type, c)
+		if err != nil {
+			return nil, fmt.Errorf("the parameter '%s' has invalid validation rules: %w", p.param.Name, err)
+		}
+
+		if has || v.fields != nil || v.elem != nil {
+			res[i].validation = v
+		}
+	}
+
+	for name := range paramConstraints {
+		return nil, fmt.Errorf("the validated parameter '%s' has no matching request parameter", name)
+	}
+
+	// keep the declaration order, so that the arguments can be passed in that order
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].idx < res[j].idx
+	})
+
+	return res, nil
+}
+
+// collectNamedParams maps the method parameters denoted by the given annotation to the according parameter type
+func collectNamedParams(method reflectplus.Method, paramsToDefine map[string]methodParam, annotation string, pt paramType, kind string) ([]methodParam, error) {
+	var res []methodParam
+	for _, a := range method.GetAnnotations().FindAll(annotation) {
 		name := a.Value()
 		if len(name) == 0 {
-			return nil, fmt.Errorf("value of '%s' must not be empty", AnnotationHeaderParam)
+			return nil, fmt.Errorf("value of '%s' must not be empty", annotation)
 		}
 
 		if _, has := paramsToDefine[name]; !has {
-			return nil, fmt.Errorf("the header parameter '%s' has no matching method parameter", name)
+			return nil, fmt.Errorf("the %s parameter '%s' has no matching method parameter", kind, name)
 		}
 
-		tmp := paramsToDefine[name]
-		tmp.alias = a.AsString("alias")
-		tmp.paramType = ptHeader
+		tmp, err := parseNamedParam(a, paramsToDefine[name], pt, kind)
+		if err != nil {
+			return nil, err
+		}
 		res = append(res, tmp)
 		delete(paramsToDefine, name)
 	}
 
-	// check for parameters, which have not been defined yet
-	for _, p := range paramsToDefine {
-		return nil, fmt.Errorf("method parameter '%s' has not been mapped to a request parameter", p.param.Name)
+	return res, nil
+}
+
+// parseNamedParam applies the alias, style, required and default properties of the annotation to the parameter.
+func parseNamedParam(a reflectplus.Annotation, p methodParam, pt paramType, kind string) (methodParam, error) {
+	p.alias = a.AsString("alias")
+	p.paramType = pt
+	p.style = a.AsString("style")
+	switch p.style {
+	case "":
+		p.style = styleMulti
+		if pt == ptHeader || pt == ptCookie {
+			p.style = styleCSV
+		}
+	case styleMulti, styleCSV:
+	default:
+		return p, fmt.Errorf("the %s parameter '%s' has an unsupported style '%s'", kind, p.param.Name, p.style)
+	}
+
+	p.required = pt == ptPath || a.AsString("required") == "true"
+	p.defaultValue = a.AsString("default")
+	if p.required && len(p.defaultValue) > 0 {
+		return p, fmt.Errorf("the %s parameter '%s' is required and cannot have a default value", kind, p.param.Name)
+	}
+
+	return p, nil
+}
+
+// scanBeanFields returns the annotated fields of the declared struct as parameters.
+func scanBeanFields(decl reflectplus.TypeDecl) ([]methodParam, error) {
+	strct := reflectplus.FindStruct(decl.ImportPath, decl.Identifier)
+	if strct == nil || decl.Stars > 1 {
+		return nil, fmt.Errorf("type must be a struct or a pointer to a struct")
+	}
+
+	var res []methodParam
+	for _, f := range strct.Fields {
+		for _, named := range []struct {
+			annotation string
+			paramType  paramType
+			kind       string
+		}{
+			{AnnotationPathParam, ptPath, "path"},
+			{AnnotationQueryParam, ptQuery, "query"},
+			{AnnotationHeaderParam, ptHeader, "header"},
+			{AnnotationCookieParam, ptCookie, "cookie"},
+		} {
+			a := reflectplus.Annotations(f.Annotations).FindFirst(named.annotation)
+			if a == nil {
+				continue
+			}
+
+			if !ast.IsExported(f.Name) {
+				return nil, fmt.Errorf("the %s field '%s' must be exported", named.kind, f.Name)
+			}
+
+			p, err := parseNamedParam(*a, methodParam{param: reflectplus.Param{Doc: f.Doc, Name: f.Name, Type: f.Type}}, named.paramType, named.kind)
+			if err != nil {
+				return nil, err
+			}
+
+			// the bean is validated as a whole, this is only used to document the fields
+			c, err := fieldConstraints(f)
+			if err != nil {
+				return nil, err
+			}
+			p.validation = &validation{constraints: c}
+
+			res = append(res, p)
+		}
+	}
+
+	return res, nil
+}
+
+// expandBeans replaces all bean parameters by their fields.
+func expandBeans(params []methodParam) []methodParam {
+	var res []methodParam
+	for _, p := range params {
+		if p.paramType == ptBean {
+			res = append(res, p.fields...)
+			continue
+		}
+		res = append(res, p)
+	}
+	return res
+}
+
+// requestValues returns all raw values of a path, query, header, cookie or (already parsed) form parameter.
+func requestValues(p methodParam, request *http.Request, params KeyValues) []string {
+	switch p.paramType {
+	case ptPath:
+		return []string{params.ByName(p.Alias())}
+	case ptQuery:
+		return request.URL.Query()[p.Alias()]
+	case ptHeader:
+		return request.Header.Values(p.Alias())
+	case ptCookie:
+		var res []string
+		for _, cookie := range request.Cookies() {
+			if cookie.Name == p.Alias() {
+				res = append(res, cookie.Value)
+			}
+		}
+		return res
+	case ptForm:
+		return request.PostForm[p.Alias()]
+	default:
+		panic("method parameter type " + strconv.Itoa(int(p.paramType)) + " has no values")
+	}
+}
+
+// bindValues converts the raw values into the parameters type. Slices (except []byte) receive all values, split
+// by comma in case of the csv style, and all other types only the first value. Absent values are replaced by
+// the default value, otherwise pointers become nil and all other types their zero value.
+func bindValues(srv *Server, values []string, p methodParam, dstType reflect.Type) (reflect.Value, error) {
+	if len(values) == 0 {
+		if p.required {
+			return reflect.Value{}, p.newError(IdParamMissing, fmt.Sprintf("the required %s parameter '%s' is missing", p.location(), p.Alias()), nil)
+		}
+
+		if len(p.defaultValue) == 0 {
+			return reflect.Zero(dstType), nil
+		}
+
+		values = []string{p.defaultValue}
+	}
+
+	if dstType.Kind() == reflect.Ptr && !srv.hasConverter(dstType) {
+		elemParam := p
+		elemParam.param.Type.Stars--
+		elem, err := bindValues(srv, values, elemParam, dstType.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		ptr := reflect.New(dstType.Elem())
+		ptr.Elem().Set(elem)
+		return ptr, nil
+	}
+
+	if dstType.Kind() != reflect.Slice || dstType.Elem().Kind() == reflect.Uint8 || srv.hasConverter(dstType) {
+		value, err := srv.convert(values[0], dstType)
+		if err != nil {
+			return reflect.Value{}, p.newError(IdParamInvalid, fmt.Sprintf("the %s parameter '%s' is invalid", p.location(), p.Alias()), err)
+		}
+		return value, nil
+	}
+
+	if p.style == styleCSV {
+		var tmp []string
+		for _, v := range values {
+			for _, s := range strings.Split(v, ",") {
+				tmp = append(tmp, strings.TrimSpace(s))
+			}
+		}
+		values = tmp
+	}
+
+	res := reflect.MakeSlice(dstType, 0, len(values))
+	for _, v := range values {
+		value, err := srv.convert(v, dstType.Elem())
+		if err != nil {
+			return reflect.Value{}, p.newError(IdParamInvalid, fmt.Sprintf("the %s parameter '%s' is invalid", p.location(), p.Alias()), err)
+		}
+		res = reflect.Append(res, value)
 	}
 
 	return res, nil
 }
 
+// checkDefaults converts the default values of the parameters and bean fields, so that an invalid default is
+// reported as an error of the method declaration and not as an invalid parameter of each request.
+func checkDefaults(srv *Server, params []methodParam, funcType reflect.Type) error {
+	for _, p := range params {
+		dstType := funcType.In(p.idx)
+		if p.paramType == ptBean {
+			structType := dstType
+			if structType.Kind() == reflect.Ptr {
+				structType = structType.Elem()
+			}
+
+			for _, f := range p.fields {
+				field, _ := structType.FieldByName(f.param.Name)
+				if err := checkDefault(srv, f, field.Type); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if err := checkDefault(srv, p, dstType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkDefault converts the default value of the parameter, if it has any.
+func checkDefault(srv *Server, p methodParam, dstType reflect.Type) error {
+	if len(p.defaultValue) == 0 {
+		return nil
+	}
+
+	if _, err := bindValues(srv, nil, p, dstType); err != nil {
+		return fmt.Errorf("the default value '%s' of the %s parameter '%s' is invalid: %w", p.defaultValue, p.location(), p.Alias(), errors.Unwrap(err))
+	}
+	return nil
+}
+
+// bindBean creates a new struct (or pointer to a struct) and binds the request values to its annotated fields.
+func bindBean(srv *Server, p methodParam, dstType reflect.Type, request *http.Request, params KeyValues) (reflect.Value, error) {
+	structType := dstType
+	if structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+
+	bean := reflect.New(structType)
+	for _, f := range p.fields {
+		field := bean.Elem().FieldByName(f.param.Name)
+		value, err := bindValues(srv, requestValues(f, request, params), f, field.Type())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		field.Set(value)
+	}
+
+	if dstType.Kind() == reflect.Ptr {
+		return bean, nil
+	}
+
+	return bean.Elem(), nil
+}
+
+// containsString returns true, if the slice contains the string.
+func containsString(slice []string, s string) bool {
+	for _, v := range slice {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 func paramNamesFromRoute(route string) []string {
 	names := regexParamNames.FindAllString(string(route), -1)
 	for i, n := range names {
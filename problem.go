@@ -0,0 +1,96 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// MediaTypeProblemJSON is the media type of RFC 7807 problem details.
+const MediaTypeProblemJSON = "application/problem+json"
+
+// Problem is the RFC 7807 representation of an Error. The members localizedMessage, causedBy, class and details
+// are extensions, so that no information of the Error gets lost.
+type Problem struct {
+	Type             string      `json:"type"`                       // Type is the Error.Id
+	Title            string      `json:"title,omitempty"`            // Title is the text of the status code
+	Status           int         `json:"status,omitempty"`           // Status is the http status code
+	Detail           string      `json:"detail,omitempty"`           // Detail is the Error.Message
+	Instance         string      `json:"instance,omitempty"`         // Instance is the path of the request
+	LocalizedMessage string      `json:"localizedMessage,omitempty"` // LocalizedMessage is the Error.LocalizedMessage
+	CausedBy         *Error      `json:"causedBy,omitempty"`         // CausedBy is the Error.CausedBy
+	Class            string      `json:"class,omitempty"`            // Class is the Error.Type
+	Details          interface{} `json:"details,omitempty"`          // Details is the Error.Details
+	CorrelationId    string      `json:"correlationId,omitempty"`    // CorrelationId is the Error.CorrelationId
+}
+
+// newProblem converts the error, which has been caused by the request.
+func newProblem(err *Error, status int, request *http.Request) Problem {
+	return Problem{
+		Type:             err.Id,
+		Title:            http.StatusText(status),
+		Status:           status,
+		Detail:           err.Message,
+		Instance:         request.URL.Path,
+		LocalizedMessage: err.LocalizedMessage,
+		CausedBy:         err.CausedBy,
+		Class:            err.Type,
+		Details:          err.Details,
+		CorrelationId:    err.CorrelationId,
+	}
+}
+
+// ToError converts the problem back. If there is no detail, the title becomes the message.
+func (p Problem) ToError() *Error {
+	msg := p.Detail
+	if len(msg) == 0 {
+		msg = p.Title
+	}
+
+	return &Error{
+		Id:               p.Type,
+		Message:          msg,
+		LocalizedMessage: p.LocalizedMessage,
+		CausedBy:         p.CausedBy,
+		Type:             p.Class,
+		Details:          p.Details,
+		CorrelationId:    p.CorrelationId,
+	}
+}
+
+// SetProblemDetails renders errors as RFC 7807 documents with the media type MediaTypeProblemJSON, instead of the
+// json serialization of Error.
+func (s *Server) SetProblemDetails(enabled bool) {
+	s.problemDetails = enabled
+}
+
+// errMediaType returns the media type of rendered errors.
+func (s *Server) errMediaType() string {
+	if s.problemDetails {
+		return MediaTypeProblemJSON
+	}
+	return MediaTypeJSON
+}
+
+// marshalProblemByte is like marshalErrByte but renders a Problem.
+func marshalProblemByte(err error, status int, request *http.Request) []byte {
+	buf, err2 := json.Marshal(newProblem(AsError(err), status, request))
+	if err2 != nil {
+		return []byte(fmt.Errorf("suppressed error by: %w", err2).Error())
+	}
+	return buf
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"bytes"
+	"net/http"
+	"reflect"
+)
+
+// pkgPath is the import path of this package, to detect its types in the parsed declarations.
+var pkgPath = reflect.TypeOf(Response{}).PkgPath()
+
+// Response is an envelope for the result of a controller method, to control the status code and the headers of
+// the response. Other result types may also implement StatusCode() int and Headers() http.Header instead.
+type Response struct {
+	Status int         // Status overrides the declared status code, if not 0
+	Header http.Header // Header contains additional response headers
+	Body   interface{} // Body is encoded by the negotiated codec and may be nil
+}
+
+// StatusCode returns the status
+func (r Response) StatusCode() int {
+	return r.Status
+}
+
+// Headers returns the header
+func (r Response) Headers() http.Header {
+	return r.Header
+}
+
+// writeResult writes the status, headers and encoded body of a result.
+func writeResult(srv *Server, writer http.ResponseWriter, mediaType string, status int, result interface{}) error {
+	body := result
+	switch r := result.(type) {
+	case Response:
+		body = r.Body
+	case *Response:
+		body = r.Body
+	}
+
+	if sc, ok := result.(interface{ StatusCode() int }); ok && sc.StatusCode() != 0 {
+		status = sc.StatusCode()
+	}
+
+	if h, ok := result.(interface{ Headers() http.Header }); ok {
+		for key, values := range h.Headers() {
+			for _, v := range values {
+				writer.Header().Add(key, v)
+			}
+		}
+	}
+
+	if body == nil || !bodyAllowed(status) {
+		writer.WriteHeader(status)
+		return nil
+	}
+
+	buf := &bytes.Buffer{}
+	if err := srv.codec(mediaType).Encode(buf, body); err != nil {
+		return err
+	}
+
+	writer.Header().Set("Content-Type", mediaType)
+	writer.WriteHeader(status)
+	_, err := writer.Write(buf.Bytes())
+	return err
+}
+
+// bodyAllowed returns false for the status codes which must not have a body.
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
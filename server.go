@@ -15,21 +15,53 @@
 package http
 
 import (
+	"context"
 	"fmt"
 	"github.com/julienschmidt/httprouter"
 	"net/http"
+	"reflect"
+	"runtime/debug"
 	"strconv"
+	"time"
 )
 
 type Server struct {
 	routes     *httprouter.Router
 	middleware []func(Handler) Handler
+	converters map[reflect.Type]converter
+	injectors  map[reflect.Type]func(*http.Request) (interface{}, error)
+	codecs     []mediaCodec
+
+	errorStatus    map[string]int // errorStatus maps registered Error ids to http status codes
+	problemDetails bool           // problemDetails renders errors as RFC 7807 documents
+	messages       *MessageCatalog
+	logger         Logger
+	accessLog      *accessLog
+	errorExposure  ErrorExposure
+	publicDetails  map[string]bool // publicDetails contains the ids, whose details are exposed publicly
+	eventKeepAlive time.Duration
+	debug          bool // debug exposes the stack trace of recovered panics
 }
 
 func NewServer() *Server {
-	return &Server{
-		routes: httprouter.New(),
+	s := &Server{
+		routes:     httprouter.New(),
+		converters: map[reflect.Type]converter{},
+		injectors:  map[reflect.Type]func(*http.Request) (interface{}, error){},
+
+		errorStatus:    map[string]int{},
+		publicDetails:  map[string]bool{},
+		logger:         nopLogger{},
+		eventKeepAlive: defaultEventKeepAlive,
 	}
+
+	for id, status := range defaultErrorStatus {
+		s.errorStatus[id] = status
+	}
+
+	s.AllowErrorDetails(defaultPublicDetails...)
+	s.RegisterCodec(MediaTypeJSON, jsonCodec{})
+	return s
 }
 
 func (s *Server) Use(middleware func(Handler) Handler) {
@@ -43,21 +75,119 @@ func (s *Server) Handle(method, path string, handle Handler) {
 
 func (s *Server) handle(method, path string, handle Handler) {
 	s.routes.Handle(method, path, func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		start := time.Now()
+		tracked := &responseWriter{ResponseWriter: writer}
+		request = request.WithContext(context.WithValue(request.Context(), routeKey{}, path))
+		defer func() {
+			// net/http only removes the temporary files of the original request, but the form is parsed on the copy
+			if request.MultipartForm != nil {
+				_ = request.MultipartForm.RemoveAll()
+			}
+		}()
+
+		if s.accessLog != nil {
+			defer s.accessLog.log(tracked, request, start) // runs last, to see the status of a recovered panic
+		}
+
+		defer func() {
+			if r := recover(); r != nil {
+				s.recoverPanic(tracked, request, r)
+			}
+		}()
+
 		myHandler := handle
 		for i := len(s.middleware) - 1; i >= 0; i-- {
 			myHandler = s.middleware[i](myHandler)
 		}
-		err := myHandler(writer, request, wrapRouterParams(params))
+		err := myHandler(tracked, request, wrapRouterParams(params))
 		if err != nil {
-			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
-			writer.Header().Set("X-Content-Type-Options", "nosniff")
-			writer.WriteHeader(http.StatusBadRequest)
-			writer.Write(marshalErrByte(err))
-			fmt.Println("error", err)
+			s.writeError(tracked, request, err)
 		}
 	})
 }
 
+// SetDebug adds the recovered value and the stack trace of a panic to the details of its Error. It is disabled by
+// default and must not be enabled in production, because the stack trace reveals the internals of the server.
+func (s *Server) SetDebug(enabled bool) {
+	s.debug = enabled
+}
+
+// recoverPanic logs the recovered value with its stack trace and writes an Error with the id IdPanic. The stack
+// trace is only part of the details in debug mode. If the response has already been started, the connection is
+// aborted instead, so that the client cannot mistake a truncated response for a complete one.
+func (s *Server) recoverPanic(writer *responseWriter, request *http.Request, r interface{}) {
+	if r == http.ErrAbortHandler {
+		panic(r)
+	}
+
+	stack := string(debug.Stack())
+	s.logger.Log(LevelError, "recovered panic", "verb", request.Method, "route", routeOf(request), "panic", r,
+		"stack", stack)
+
+	if writer.hijacked {
+		return
+	}
+
+	if writer.written() {
+		panic(http.ErrAbortHandler)
+	}
+
+	err := &Error{Id: IdPanic, Message: "the request caused a panic"}
+	if s.debug {
+		err.Details = map[string]interface{}{
+			"panic": fmt.Sprint(r),
+			"stack": stack,
+		}
+	}
+	s.writeError(writer, request, err)
+}
+
+// writeError writes the error with the status code determined by statusOf. If the response has already been
+// started or the connection has been hijacked, the error is only logged.
+func (s *Server) writeError(writer *responseWriter, request *http.Request, err error) {
+	if writer.hijacked || writer.written() {
+		s.logAborted(request, err)
+		return
+	}
+
+	status := s.statusOf(err)
+	exposed, correlationId := s.expose(s.localize(AsError(err), request), request)
+	writer.Header().Set("Content-Type", s.errMediaType()+"; charset=utf-8")
+	writer.Header().Set("X-Content-Type-Options", "nosniff")
+	if len(correlationId) > 0 {
+		writer.Header().Set(HeaderRequestId, correlationId)
+	}
+	writer.WriteHeader(status)
+	if s.problemDetails {
+		writer.Write(marshalProblemByte(exposed, status, request))
+	} else {
+		writer.Write(marshalErrByte(exposed))
+	}
+
+	level := LevelWarn
+	if status >= 500 {
+		level = LevelError
+	}
+
+	fields := []interface{}{"verb", request.Method, "route", routeOf(request), "status", status, "errorId", AsError(err).Id}
+	if len(correlationId) > 0 {
+		// the hidden parts are only available in the log
+		fields = append(fields, "correlationId", correlationId, "error", AsError(err).String())
+	} else {
+		fields = append(fields, "error", err)
+	}
+	s.logger.Log(level, "request failed", fields...)
+}
+
+// routeKey is the context key of the route pattern.
+type routeKey struct{}
+
+// routeOf returns the pattern of the matched route, e.g. /api/v1/sms/:id.
+func routeOf(request *http.Request) string {
+	route, _ := request.Context().Value(routeKey{}).(string)
+	return route
+}
+
 func (s *Server) Start(port int) error {
 	return http.ListenAndServe(":"+strconv.Itoa(port), s.routes)
 }
@@ -0,0 +1,82 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"os"
+)
+
+// defaultErrorStatus maps the ids of errors raised by this package to their http status code.
+var defaultErrorStatus = map[string]int{
+	IdBodyInvalid:          http.StatusBadRequest,
+	IdParamMissing:         http.StatusBadRequest,
+	IdParamInvalid:         http.StatusBadRequest,
+	IdValidation:           http.StatusBadRequest,
+	IdNotFound:             http.StatusNotFound,
+	IdNotAcceptable:        http.StatusNotAcceptable,
+	IdUnsupportedMediaType: http.StatusUnsupportedMediaType,
+	IdWebSocketUpgrade:     http.StatusUpgradeRequired,
+	IdPanic:                http.StatusInternalServerError,
+}
+
+// sentinelStatus maps well known errors of the standard library to their http status code.
+var sentinelStatus = []struct {
+	err    error
+	status int
+}{
+	{context.DeadlineExceeded, http.StatusGatewayTimeout},
+	{sql.ErrNoRows, http.StatusNotFound},
+	{os.ErrNotExist, http.StatusNotFound},
+	{os.ErrPermission, http.StatusForbidden},
+}
+
+// RegisterErrorStatus maps the Error.Id to the http status code, e.g. mydomain.not.assigned to 403. A status
+// registered for an id of this package, like IdValidation, replaces the default.
+func (s *Server) RegisterErrorStatus(id string, status int) {
+	s.errorStatus[id] = status
+}
+
+// statusOf determines the http status code of an error by the first matching rule:
+//  1. an error in the chain implements StatusCode() int and returns a valid status
+//  2. an Error.Id in the chain has been registered by RegisterErrorStatus, starting at the outermost error
+//  3. an error in the chain is context.DeadlineExceeded (504), sql.ErrNoRows (404), os.ErrNotExist (404) or
+//     os.ErrPermission (403)
+//  4. everything else is an internal server error (500)
+func (s *Server) statusOf(err error) int {
+	var coder interface{ StatusCode() int }
+	if errors.As(err, &coder) {
+		if status := coder.StatusCode(); status >= 400 && status <= 599 {
+			return status
+		}
+	}
+
+	for e := AsError(err); e != nil; e = e.CausedBy {
+		if status, ok := s.errorStatus[e.Id]; ok {
+			return status
+		}
+	}
+
+	for _, sentinel := range sentinelStatus {
+		if errors.Is(err, sentinel.err) {
+			return sentinel.status
+		}
+	}
+
+	return http.StatusInternalServerError
+}
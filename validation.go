@@ -0,0 +1,286 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"fmt"
+	v3 "github.com/golangee/openapi/v3"
+	"github.com/golangee/reflectplus"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Violation describes a single failed constraint of a parameter or field. An Error with the id IdValidation
+// contains all violations of a request as details.
+type Violation struct {
+	Field      string `json:"field"`      // Field is the path of the parameter or field, e.g. dto.Address.Zip
+	Constraint string `json:"constraint"` // Constraint is the name of the violated constraint, e.g. maxLength
+	Message    string `json:"message"`    // Message explains the violation to the developer
+}
+
+// constraints are the declared validation rules of a single value.
+type constraints struct {
+	min, max             *float64
+	minLength, maxLength *int
+	pattern              *regexp.Regexp
+	enum                 []string
+}
+
+// parseConstraints reads the constraints from an AnnotationValidate.
+func parseConstraints(a reflectplus.Annotation) (constraints, error) {
+	c := constraints{}
+	for _, bound := range []struct {
+		key string
+		dst **float64
+	}{{"min", &c.min}, {"max", &c.max}} {
+		if v := a.AsString(bound.key); len(v) > 0 {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return c, fmt.Errorf("'%s' of '%s' must be a number: %w", bound.key, AnnotationValidate, err)
+			}
+			*bound.dst = &f
+		}
+	}
+
+	for _, bound := range []struct {
+		key string
+		dst **int
+	}{{"minLength", &c.minLength}, {"maxLength", &c.maxLength}} {
+		if v := a.AsString(bound.key); len(v) > 0 {
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				return c, fmt.Errorf("'%s' of '%s' must be an integer: %w", bound.key, AnnotationValidate, err)
+			}
+			*bound.dst = &i
+		}
+	}
+
+	if v := a.AsString("pattern"); len(v) > 0 {
+		regex, err := regexp.Compile(v)
+		if err != nil {
+			return c, fmt.Errorf("'pattern' of '%s' is invalid: %w", AnnotationValidate, err)
+		}
+		c.pattern = regex
+	}
+
+	if v := a.AsString("enum"); len(v) > 0 {
+		for _, s := range strings.Split(v, ",") {
+			c.enum = append(c.enum, strings.TrimSpace(s))
+		}
+	}
+
+	return c, nil
+}
+
+// check appends a Violation for each constraint which is not satisfied by the given (dereferenced) value.
+func (c constraints) check(field string, v reflect.Value, res []Violation) []Violation {
+	var num *float64
+	length := -1
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f := float64(v.Int())
+		num = &f
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		f := float64(v.Uint())
+		num = &f
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		num = &f
+	case reflect.String:
+		length = utf8.RuneCountInString(v.String())
+		if c.pattern != nil && !c.pattern.MatchString(v.String()) {
+			res = append(res, Violation{field, "pattern", fmt.Sprintf("must match the pattern '%s'", c.pattern)})
+		}
+	case reflect.Slice, reflect.Array, reflect.Map:
+		length = v.Len()
+	}
+
+	if num != nil && c.min != nil && *num < *c.min {
+		res = append(res, Violation{field, "min", fmt.Sprintf("must be at least %v", *c.min)})
+	}
+
+	if num != nil && c.max != nil && *num > *c.max {
+		res = append(res, Violation{field, "max", fmt.Sprintf("must be at most %v", *c.max)})
+	}
+
+	if length >= 0 && c.minLength != nil && length < *c.minLength {
+		res = append(res, Violation{field, "minLength", fmt.Sprintf("must have a length of at least %d", *c.minLength)})
+	}
+
+	if length >= 0 && c.maxLength != nil && length > *c.maxLength {
+		res = append(res, Violation{field, "maxLength", fmt.Sprintf("must have a length of at most %d", *c.maxLength)})
+	}
+
+	if str, ok := scalarString(v); ok && len(c.enum) > 0 {
+		found := false
+		for _, e := range c.enum {
+			if e == str {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			res = append(res, Violation{field, "enum", fmt.Sprintf("must be one of %s", strings.Join(c.enum, ", "))})
+		}
+	}
+
+	return res
+}
+
+// scalarString formats the value of a basic kind, without requiring it to be exported.
+func scalarString(v reflect.Value) (string, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), true
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), true
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64), true
+	default:
+		return "", false
+	}
+}
+
+// apply adds the constraints to the OpenAPI schema.
+func (c constraints) apply(schema *v3.Schema) {
+	schema.Minimum = c.min
+	schema.Maximum = c.max
+	if schema.Type == v3.Array {
+		schema.MinItems = c.minLength
+		schema.MaxItems = c.maxLength
+	} else {
+		schema.MinLength = c.minLength
+		schema.MaxLength = c.maxLength
+	}
+
+	if c.pattern != nil {
+		schema.Pattern = c.pattern.String()
+	}
+
+	for _, e := range c.enum {
+		schema.Enum = append(schema.Enum, schemaDefault(*schema, e))
+	}
+}
+
+// validation describes the constraints of a value and those of the fields of its struct or element type.
+type validation struct {
+	constraints constraints
+	fields      *structFields // fields is shared by all usages of a struct type and nil for other types
+	elem        *validation
+}
+
+type structFields []fieldValidation
+
+type fieldValidation struct {
+	name string
+	*validation
+}
+
+// newValidation builds the validation rules for the declared type, with the given constraints for the value itself
+// and the AnnotationValidate constraints of the fields of (nested) structs.
+func newValidation(decl reflectplus.TypeDecl, c constraints) (*validation, error) {
+	return newTypeValidation(decl, c, map[string]*structFields{})
+}
+
+func newTypeValidation(decl reflectplus.TypeDecl, c constraints, structs map[string]*structFields) (*validation, error) {
+	if decl.ImportPath == "" && decl.Identifier == "[]" {
+		elem, err := newTypeValidation(decl.Params[0], constraints{}, structs)
+		if err != nil {
+			return nil, err
+		}
+		return &validation{constraints: c, elem: elem}, nil
+	}
+
+	strct := reflectplus.FindStruct(decl.ImportPath, decl.Identifier)
+	if strct == nil {
+		return &validation{constraints: c}, nil
+	}
+
+	// the fields of a struct are shared by all usages, which also terminates recursive types
+	xid := decl.ImportPath + "#" + decl.Identifier
+	fields, has := structs[xid]
+	if !has {
+		fields = &structFields{}
+		structs[xid] = fields
+		for _, f := range strct.Fields {
+			fc, err := fieldConstraints(f)
+			if err != nil {
+				return nil, fmt.Errorf("field '%s': %w", f.Name, err)
+			}
+
+			fv, err := newTypeValidation(f.Type, fc, structs)
+			if err != nil {
+				return nil, err
+			}
+
+			*fields = append(*fields, fieldValidation{name: f.Name, validation: fv})
+		}
+	}
+
+	return &validation{constraints: c, fields: fields}, nil
+}
+
+// fieldConstraints returns the constraints of an AnnotationValidate of the field, if any.
+func fieldConstraints(f reflectplus.Field) (constraints, error) {
+	a := reflectplus.Annotations(f.Annotations).FindFirst(AnnotationValidate)
+	if a == nil {
+		return constraints{}, nil
+	}
+
+	return parseConstraints(*a)
+}
+
+// validate appends the violations of the value and of its fields or elements.
+func (r *validation) validate(field string, v reflect.Value, res []Violation) []Violation {
+	if r == nil {
+		return res
+	}
+
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return res
+		}
+		v = v.Elem()
+	}
+
+	res = r.constraints.check(field, v, res)
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if r.fields == nil {
+			break
+		}
+
+		for _, f := range *r.fields {
+			res = f.validate(field+"."+f.name, v.FieldByName(f.name), res)
+		}
+	case reflect.Slice, reflect.Array:
+		if r.elem != nil {
+			for i := 0; i < v.Len(); i++ {
+				res = r.elem.validate(field+"["+strconv.Itoa(i)+"]", v.Index(i), res)
+			}
+		}
+	}
+
+	return res
+}
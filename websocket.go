@@ -0,0 +1,386 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/golangee/reflectplus"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// IdWebSocketUpgrade is the Error.Id used if a WebSocket endpoint is requested without a valid upgrade handshake.
+const IdWebSocketUpgrade = "ee.http.websocket.upgrade"
+
+// websocketGUID is defined by RFC 6455 to calculate the Sec-WebSocket-Accept header.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// defaultWebSocketReadLimit is the maximum size of an inbound message, unless changed by WebSocket.SetReadLimit.
+const defaultWebSocketReadLimit = 1 << 20
+
+// MessageType is the type of a WebSocket data message.
+type MessageType int
+
+const (
+	TextMessage   MessageType = 1 // TextMessage contains UTF-8 encoded text
+	BinaryMessage MessageType = 2 // BinaryMessage contains arbitrary bytes
+)
+
+const (
+	opContinuation = 0x0
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// Close codes as defined by RFC 6455.
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	CloseInvalidPayload  = 1007
+	ClosePolicyViolation = 1008
+	CloseMessageTooBig   = 1009
+	CloseInternalError   = 1011
+)
+
+// A CloseError is returned by the read methods, after the peer has closed the connection.
+type CloseError struct {
+	Code   int    // Code is the close code sent by the peer or 1005 if it has sent none
+	Reason string // Reason is the optional text sent by the peer
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket closed: %d %s", e.Code, e.Reason)
+}
+
+// WebSocket is an upgraded connection, which is injected into methods annotated with AnnotationWebSocket. Reading
+// is not safe for concurrent use, but writing is. Pings are answered automatically while reading. The connection
+// is closed, when the method returns.
+type WebSocket struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	ctx       context.Context
+	writeLock sync.Mutex
+	readLimit int64
+	closed    bool // closed is true after a close frame has been sent
+}
+
+// Context returns the context of the upgraded request.
+func (w *WebSocket) Context() context.Context {
+	return w.ctx
+}
+
+// SetReadLimit sets the maximum size of an inbound message in bytes. Larger messages close the connection.
+func (w *WebSocket) SetReadLimit(limit int64) {
+	w.readLimit = limit
+}
+
+// ReadMessage blocks until the next text or binary message has been received and returns it. Control frames are
+// handled transparently. After the peer closed the connection, a *CloseError is returned.
+func (w *WebSocket) ReadMessage() (MessageType, []byte, error) {
+	var msgType MessageType
+	var msg []byte
+	for {
+		fin, opcode, payload, err := w.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch opcode {
+		case opPing:
+			if err := w.writeFrame(opPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			closeErr := &CloseError{Code: 1005}
+			if len(payload) >= 2 {
+				closeErr.Code = int(binary.BigEndian.Uint16(payload))
+				closeErr.Reason = string(payload[2:])
+			}
+			if closeErr.Code == 1005 {
+				_ = w.Close() // 1005 must not be sent
+			} else {
+				_ = w.CloseWith(closeErr.Code, "")
+			}
+			return 0, nil, closeErr
+		case opContinuation:
+			if msgType == 0 {
+				return 0, nil, w.fail(CloseProtocolError, "unexpected continuation frame")
+			}
+		case byte(TextMessage), byte(BinaryMessage):
+			if msgType != 0 {
+				return 0, nil, w.fail(CloseProtocolError, "expected a continuation frame")
+			}
+			msgType = MessageType(opcode)
+		default:
+			return 0, nil, w.fail(CloseProtocolError, fmt.Sprintf("unknown opcode %d", opcode))
+		}
+
+		if int64(len(msg)+len(payload)) > w.readLimit {
+			return 0, nil, w.fail(CloseMessageTooBig, "the message is too big")
+		}
+		msg = append(msg, payload...)
+
+		if fin {
+			if msgType == TextMessage && !utf8.Valid(msg) {
+				return 0, nil, w.fail(CloseInvalidPayload, "the text message is not valid UTF-8")
+			}
+			return msgType, msg, nil
+		}
+	}
+}
+
+// WriteMessage sends a text or binary message in a single frame.
+func (w *WebSocket) WriteMessage(msgType MessageType, data []byte) error {
+	if msgType != TextMessage && msgType != BinaryMessage {
+		return fmt.Errorf("invalid message type %d", msgType)
+	}
+	return w.writeFrame(byte(msgType), data)
+}
+
+// ReadJSON reads the next message and decodes it as JSON into v.
+func (w *WebSocket) ReadJSON(v interface{}) error {
+	_, msg, err := w.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(msg, v)
+}
+
+// WriteJSON encodes v as JSON and sends it as a text message.
+func (w *WebSocket) WriteJSON(v interface{}) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return w.WriteMessage(TextMessage, buf)
+}
+
+// Close sends a normal close frame and closes the connection.
+func (w *WebSocket) Close() error {
+	return w.CloseWith(CloseNormal, "")
+}
+
+// CloseWith sends a close frame with the given code and reason and closes the connection. Closing an already
+// closed connection has no effect.
+func (w *WebSocket) CloseWith(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > 125 {
+		payload = payload[:125] // control frames must not be larger
+	}
+
+	w.writeLock.Lock()
+	defer w.writeLock.Unlock()
+
+	if w.closed {
+		return nil
+	}
+
+	err := w.write(opClose, payload)
+	w.closed = true
+	if closeErr := w.conn.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// fail closes the connection with the given code and returns the reason as error.
+func (w *WebSocket) fail(code int, reason string) error {
+	_ = w.CloseWith(code, reason)
+	return &CloseError{Code: code, Reason: reason}
+}
+
+// readFrame reads a single frame and unmasks its payload. Clients must mask all frames.
+func (w *WebSocket) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(w.reader, head[:]); err != nil {
+		return
+	}
+
+	fin = head[0]&0x80 != 0
+	opcode = head[0] & 0x0F
+	if head[0]&0x70 != 0 {
+		return fin, opcode, nil, w.fail(CloseProtocolError, "reserved bits must not be set")
+	}
+
+	if head[1]&0x80 == 0 {
+		return fin, opcode, nil, w.fail(CloseProtocolError, "client frames must be masked")
+	}
+
+	length := int64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(w.reader, ext[:]); err != nil {
+			return
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(w.reader, ext[:]); err != nil {
+			return
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+
+	if opcode >= opClose && (length > 125 || !fin) {
+		return fin, opcode, nil, w.fail(CloseProtocolError, "invalid control frame")
+	}
+
+	if length < 0 || length > w.readLimit {
+		return fin, opcode, nil, w.fail(CloseMessageTooBig, "the message is too big")
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(w.reader, mask[:]); err != nil {
+		return
+	}
+
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(w.reader, payload); err != nil {
+		return
+	}
+
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return
+}
+
+// writeFrame writes a single unmasked and final frame.
+func (w *WebSocket) writeFrame(opcode byte, payload []byte) error {
+	w.writeLock.Lock()
+	defer w.writeLock.Unlock()
+
+	if w.closed {
+		return fmt.Errorf("the websocket has been closed")
+	}
+
+	return w.write(opcode, payload)
+}
+
+// write must be called with the lock held.
+func (w *WebSocket) write(opcode byte, payload []byte) error {
+	head := make([]byte, 2, 10+len(payload))
+	head[0] = 0x80 | opcode
+	switch {
+	case len(payload) < 126:
+		head[1] = byte(len(payload))
+	case len(payload) <= 0xFFFF:
+		head[1] = 126
+		head = append(head, 0, 0)
+		binary.BigEndian.PutUint16(head[2:], uint16(len(payload)))
+	default:
+		head[1] = 127
+		head = append(head, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(head[2:], uint64(len(payload)))
+	}
+
+	_, err := w.conn.Write(append(head, payload...))
+	return err
+}
+
+// upgradeWebSocket validates the handshake of RFC 6455 and takes over the connection. Headers, which have already
+// been set on the writer (e.g. by a middleware), are sent with the 101 response.
+func upgradeWebSocket(writer http.ResponseWriter, request *http.Request) (*WebSocket, error) {
+	key := request.Header.Get("Sec-WebSocket-Key")
+	keyBytes, keyErr := base64.StdEncoding.DecodeString(key)
+	switch {
+	case request.Method != http.MethodGet:
+		return nil, newUpgradeError(writer, "the websocket handshake requires the GET method")
+	case !headerContainsToken(request.Header, "Connection", "upgrade"):
+		return nil, newUpgradeError(writer, "the Connection header must contain 'upgrade'")
+	case !headerContainsToken(request.Header, "Upgrade", "websocket"):
+		return nil, newUpgradeError(writer, "the Upgrade header must contain 'websocket'")
+	case request.Header.Get("Sec-WebSocket-Version") != "13":
+		return nil, newUpgradeError(writer, "only the websocket version 13 is supported")
+	case keyErr != nil || len(keyBytes) != 16:
+		return nil, newUpgradeError(writer, "the Sec-WebSocket-Key header is invalid")
+	}
+
+	hijacker, ok := writer.(http.Hijacker)
+	if !ok {
+		return nil, fmt.Errorf("the response writer does not support hijacking: %T", writer)
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	// the deadlines of the http server must not apply to the long living connection
+	_ = conn.SetDeadline(time.Time{})
+
+	hash := sha1.Sum([]byte(key + websocketGUID))
+	sb := &strings.Builder{}
+	sb.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	sb.WriteString("Upgrade: websocket\r\n")
+	sb.WriteString("Connection: Upgrade\r\n")
+	sb.WriteString("Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(hash[:]) + "\r\n")
+	for name, values := range writer.Header() {
+		for _, v := range values {
+			sb.WriteString(name + ": " + singleLine(v) + "\r\n")
+		}
+	}
+	sb.WriteString("\r\n")
+
+	if _, err := conn.Write([]byte(sb.String())); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return &WebSocket{conn: conn, reader: rw.Reader, ctx: request.Context(), readLimit: defaultWebSocketReadLimit}, nil
+}
+
+// newUpgradeError announces the supported websocket version, as required by RFC 6455.
+func newUpgradeError(writer http.ResponseWriter, msg string) *Error {
+	writer.Header().Set("Sec-WebSocket-Version", "13")
+	return &Error{Id: IdWebSocketUpgrade, Message: msg}
+}
+
+// headerContainsToken returns true, if one of the comma separated values equals the token, ignoring case.
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isWebSocketParam returns true, if the declared type is a *WebSocket.
+func isWebSocketParam(decl reflectplus.TypeDecl) bool {
+	return decl.ImportPath == pkgPath && decl.Identifier == "WebSocket" && decl.Stars == 1
+}
@@ -0,0 +1,419 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sampleKey and sampleAccept are the handshake example of RFC 6455, section 1.3.
+const (
+	sampleKey    = "dGhlIHNhbXBsZSBub25jZQ=="
+	sampleAccept = "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="
+)
+
+// testClient speaks the client side of RFC 6455 on a raw connection.
+type testClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// newEchoServer upgrades each request and echoes all messages, until the connection is closed.
+func newEchoServer(t *testing.T, readLimit int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ws, err := upgradeWebSocket(writer, request)
+		if err != nil {
+			writer.WriteHeader(http.StatusUpgradeRequired)
+			return
+		}
+
+		if readLimit > 0 {
+			ws.SetReadLimit(readLimit)
+		}
+
+		for {
+			msgType, msg, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			if err := ws.WriteMessage(msgType, msg); err != nil {
+				t.Errorf("failed to echo: %v", err)
+				return
+			}
+		}
+	}))
+}
+
+// dial performs the handshake and returns the response of the server.
+func dial(t *testing.T, srv *httptest.Server, header http.Header) (*testClient, *http.Response) {
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	request, err := http.NewRequest(http.MethodGet, srv.URL+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header = header
+
+	if err := request.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testClient{t: t, conn: conn, reader: reader}, response
+}
+
+func upgradeHeader() http.Header {
+	return http.Header{
+		"Connection":            {"keep-alive, Upgrade"},
+		"Upgrade":               {"websocket"},
+		"Sec-Websocket-Version": {"13"},
+		"Sec-Websocket-Key":     {sampleKey},
+	}
+}
+
+// dialUpgraded performs a valid handshake.
+func dialUpgraded(t *testing.T, srv *httptest.Server) *testClient {
+	client, response := dial(t, srv, upgradeHeader())
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected status 101 but got %d", response.StatusCode)
+	}
+	return client
+}
+
+// writeFrame sends a frame, which is masked unless disabled.
+func (c *testClient) writeFrame(fin bool, opcode byte, payload []byte, masked bool) {
+	buf := &bytes.Buffer{}
+	head := opcode
+	if fin {
+		head |= 0x80
+	}
+	buf.WriteByte(head)
+
+	maskBit := byte(0)
+	if masked {
+		maskBit = 0x80
+	}
+
+	switch {
+	case len(payload) < 126:
+		buf.WriteByte(maskBit | byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		buf.WriteByte(maskBit | 126)
+		_ = binary.Write(buf, binary.BigEndian, uint16(len(payload)))
+	default:
+		buf.WriteByte(maskBit | 127)
+		_ = binary.Write(buf, binary.BigEndian, uint64(len(payload)))
+	}
+
+	if masked {
+		mask := []byte{0x12, 0x34, 0x56, 0x78}
+		buf.Write(mask)
+		for i, b := range payload {
+			buf.WriteByte(b ^ mask[i%4])
+		}
+	} else {
+		buf.Write(payload)
+	}
+
+	if _, err := c.conn.Write(buf.Bytes()); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// readFrame receives a frame, which must not be masked by the server.
+func (c *testClient) readFrame() (fin bool, opcode byte, payload []byte) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.reader, head[:]); err != nil {
+		c.t.Fatal(err)
+	}
+
+	if head[1]&0x80 != 0 {
+		c.t.Fatal("server frames must not be masked")
+	}
+
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext uint16
+		if err := binary.Read(c.reader, binary.BigEndian, &ext); err != nil {
+			c.t.Fatal(err)
+		}
+		length = uint64(ext)
+	case 127:
+		if err := binary.Read(c.reader, binary.BigEndian, &length); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		c.t.Fatal(err)
+	}
+
+	return head[0]&0x80 != 0, head[0] & 0x0F, payload
+}
+
+// expectClose reads the next frame, which must be a close frame with the given code.
+func (c *testClient) expectClose(code int) {
+	_, opcode, payload := c.readFrame()
+	if opcode != opClose {
+		c.t.Fatalf("expected a close frame but got opcode %d", opcode)
+	}
+
+	if len(payload) < 2 {
+		c.t.Fatalf("expected the close code %d but got none", code)
+	}
+
+	if actual := int(binary.BigEndian.Uint16(payload)); actual != code {
+		c.t.Fatalf("expected the close code %d but got %d", code, actual)
+	}
+}
+
+func closePayload(code int, reason string) []byte {
+	payload := make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	return append(payload, reason...)
+}
+
+func TestWebSocketHandshake(t *testing.T) {
+	srv := newEchoServer(t, 0)
+	defer srv.Close()
+
+	client, response := dial(t, srv, upgradeHeader())
+	defer client.conn.Close()
+
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected status 101 but got %d", response.StatusCode)
+	}
+
+	if accept := response.Header.Get("Sec-WebSocket-Accept"); accept != sampleAccept {
+		t.Fatalf("expected the accept key '%s' but got '%s'", sampleAccept, accept)
+	}
+
+	if !headerContainsToken(response.Header, "Upgrade", "websocket") {
+		t.Fatalf("expected the upgrade to websocket but got '%s'", response.Header.Get("Upgrade"))
+	}
+}
+
+func TestWebSocketInvalidHandshake(t *testing.T) {
+	tests := []struct {
+		name   string
+		header func(http.Header)
+	}{
+		{"missing upgrade", func(h http.Header) { h.Del("Upgrade") }},
+		{"missing connection", func(h http.Header) { h.Set("Connection", "keep-alive") }},
+		{"wrong version", func(h http.Header) { h.Set("Sec-WebSocket-Version", "8") }},
+		{"short key", func(h http.Header) { h.Set("Sec-WebSocket-Key", "c2hvcnQ=") }},
+	}
+
+	srv := newEchoServer(t, 0)
+	defer srv.Close()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := upgradeHeader()
+			test.header(header)
+
+			client, response := dial(t, srv, header)
+			defer client.conn.Close()
+
+			if response.StatusCode != http.StatusUpgradeRequired {
+				t.Fatalf("expected status 426 but got %d", response.StatusCode)
+			}
+
+			if version := response.Header.Get("Sec-WebSocket-Version"); version != "13" {
+				t.Fatalf("expected the supported version 13 but got '%s'", version)
+			}
+		})
+	}
+}
+
+func TestWebSocketUpgradeError(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	_, err := upgradeWebSocket(httptest.NewRecorder(), request)
+
+	var e *Error
+	if !errors.As(err, &e) || e.Id != IdWebSocketUpgrade {
+		t.Fatalf("expected an error with the id '%s' but got %v", IdWebSocketUpgrade, err)
+	}
+}
+
+func TestWebSocketMessages(t *testing.T) {
+	tests := []struct {
+		name    string
+		frames  func(c *testClient)
+		msgType byte
+		msg     string
+	}{
+		{
+			name:    "masked text",
+			frames:  func(c *testClient) { c.writeFrame(true, byte(TextMessage), []byte("hello"), true) },
+			msgType: byte(TextMessage),
+			msg:     "hello",
+		},
+		{
+			name: "fragmented binary",
+			frames: func(c *testClient) {
+				c.writeFrame(false, byte(BinaryMessage), []byte("he"), true)
+				c.writeFrame(false, opContinuation, []byte("ll"), true)
+				c.writeFrame(true, opContinuation, []byte("o"), true)
+			},
+			msgType: byte(BinaryMessage),
+			msg:     "hello",
+		},
+		{
+			name: "ping between fragments",
+			frames: func(c *testClient) {
+				c.writeFrame(false, byte(TextMessage), []byte("hel"), true)
+				c.writeFrame(true, opPing, []byte("p"), true)
+				c.writeFrame(true, opContinuation, []byte("lo"), true)
+			},
+			msgType: byte(TextMessage),
+			msg:     "hello",
+		},
+		{
+			name:    "extended length",
+			frames:  func(c *testClient) { c.writeFrame(true, byte(TextMessage), []byte(strings.Repeat("x", 300)), true) },
+			msgType: byte(TextMessage),
+			msg:     strings.Repeat("x", 300),
+		},
+	}
+
+	srv := newEchoServer(t, 0)
+	defer srv.Close()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := dialUpgraded(t, srv)
+			defer client.conn.Close()
+
+			test.frames(client)
+
+			fin, opcode, payload := client.readFrame()
+			if opcode == opPong {
+				fin, opcode, payload = client.readFrame()
+			}
+
+			if !fin || opcode != test.msgType || string(payload) != test.msg {
+				t.Fatalf("expected the final frame %d '%s' but got %v %d '%s'", test.msgType, test.msg, fin, opcode, payload)
+			}
+		})
+	}
+}
+
+func TestWebSocketPing(t *testing.T) {
+	srv := newEchoServer(t, 0)
+	defer srv.Close()
+
+	client := dialUpgraded(t, srv)
+	defer client.conn.Close()
+
+	client.writeFrame(true, opPing, []byte("are you there"), true)
+	_, opcode, payload := client.readFrame()
+	if opcode != opPong || string(payload) != "are you there" {
+		t.Fatalf("expected a pong with the ping payload but got %d '%s'", opcode, payload)
+	}
+}
+
+func TestWebSocketProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames func(c *testClient)
+		code   int
+	}{
+		{
+			name:   "unmasked frame",
+			frames: func(c *testClient) { c.writeFrame(true, byte(TextMessage), []byte("hello"), false) },
+			code:   CloseProtocolError,
+		},
+		{
+			name:   "unexpected continuation",
+			frames: func(c *testClient) { c.writeFrame(true, opContinuation, []byte("hello"), true) },
+			code:   CloseProtocolError,
+		},
+		{
+			name:   "fragmented ping",
+			frames: func(c *testClient) { c.writeFrame(false, opPing, nil, true) },
+			code:   CloseProtocolError,
+		},
+		{
+			name:   "invalid utf8",
+			frames: func(c *testClient) { c.writeFrame(true, byte(TextMessage), []byte{0xff, 0xfe}, true) },
+			code:   CloseInvalidPayload,
+		},
+		{
+			name:   "oversize frame",
+			frames: func(c *testClient) { c.writeFrame(true, byte(BinaryMessage), make([]byte, 17), true) },
+			code:   CloseMessageTooBig,
+		},
+		{
+			name: "oversize message",
+			frames: func(c *testClient) {
+				c.writeFrame(false, byte(BinaryMessage), make([]byte, 10), true)
+				c.writeFrame(true, opContinuation, make([]byte, 10), true)
+			},
+			code: CloseMessageTooBig,
+		},
+	}
+
+	srv := newEchoServer(t, 16)
+	defer srv.Close()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := dialUpgraded(t, srv)
+			defer client.conn.Close()
+
+			test.frames(client)
+			client.expectClose(test.code)
+		})
+	}
+}
+
+func TestWebSocketCloseEcho(t *testing.T) {
+	srv := newEchoServer(t, 0)
+	defer srv.Close()
+
+	client := dialUpgraded(t, srv)
+	defer client.conn.Close()
+
+	client.writeFrame(true, opClose, closePayload(CloseGoingAway, "bye"), true)
+	client.expectClose(CloseGoingAway)
+
+	if _, err := client.reader.ReadByte(); err != io.EOF {
+		t.Fatalf("expected the server to close the connection but got %v", err)
+	}
+}
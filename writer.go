@@ -0,0 +1,108 @@
+// Copyright 2020 Torben Schinke
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// responseWriter captures the status and the size of the response, so that a failure can decide whether an error
+// can still be written and the access log knows what has been sent. It passes flushing, hijacking and pushing
+// through to the actual writer.
+type responseWriter struct {
+	http.ResponseWriter
+	status   int   // status is 0, until the header has been sent
+	bytes    int64 // bytes is the size of the written body
+	hijacked bool  // hijacked is true, after the connection has been taken over
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 && (status >= 200 || status == http.StatusSwitchingProtocols) { // other 1xx are informational
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(buf []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	n, err := w.ResponseWriter.Write(buf)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// written returns true, if the header has already been sent.
+func (w *responseWriter) written() bool {
+	return w.status != 0
+}
+
+// Flush sends any buffered data, if supported by the actual writer.
+func (w *responseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		flusher.Flush()
+	}
+}
+
+// Hijack takes over the connection, if supported by the actual writer.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("the response writer does not support hijacking: %T", w.ResponseWriter)
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		w.hijacked = true
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Push initiates a HTTP/2 server push, if supported by the actual writer.
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := w.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// Unwrap returns the actual writer.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// canFlush returns true, if the writer actually supports flushing. Wrappers like responseWriter always implement
+// http.Flusher, so they are looked through by their Unwrap method.
+func canFlush(writer http.ResponseWriter) bool {
+	for {
+		if _, ok := writer.(http.Flusher); !ok {
+			return false
+		}
+
+		wrapper, ok := writer.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return true
+		}
+		writer = wrapper.Unwrap()
+	}
+}